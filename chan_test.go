@@ -0,0 +1,124 @@
+package mailbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+func TestChan(t *testing.T) {
+	var cnt int
+	in := make(chan generic.T)
+	mb := New(testBufSize)
+	FromChan(in, mb, nil)
+	out := mb.ToChan(context.Background(), 0)
+
+	go func() {
+		for _, si := range testSet {
+			in <- si
+		}
+
+		// Closing our input channel should close the mailbox, which in turn closes out
+		close(in)
+	}()
+
+	for range out {
+		cnt++
+	}
+
+	if cnt != len(testSet) {
+		t.Fatal("Errr cnt", cnt)
+	}
+}
+
+func TestFromChanClosedMailbox(t *testing.T) {
+	in := make(chan generic.T)
+	mb := New(1)
+	FromChan(in, mb, nil)
+	mb.Close()
+
+	// Give our pump a moment to notice the close
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case in <- 1:
+		t.Fatal("Pump is still running after the mailbox was closed")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestToChanDrains(t *testing.T) {
+	mb := New(4)
+	mb.Send(1, false)
+	mb.Send(2, false)
+	mb.Close()
+
+	var msgs []generic.T
+	for msg := range mb.ToChan(context.Background(), 1) {
+		msgs = append(msgs, msg)
+	}
+
+	if len(msgs) != 2 || msgs[0] != generic.T(1) || msgs[1] != generic.T(2) {
+		t.Fatal("Invalid messages", msgs)
+	}
+}
+
+func TestFromChanRejected(t *testing.T) {
+	in := make(chan generic.T)
+	mb := NewWithOptions(4, Options{SendInterceptors: []SendInterceptor{rejectOdd}})
+	rejected := make(chan generic.T, 4)
+	FromChan(in, mb, func(msg generic.T, state StateCode) {
+		if state != StateRejected {
+			t.Error("Invalid state", state)
+		}
+
+		rejected <- msg
+	})
+
+	for i := 1; i <= 4; i++ {
+		in <- i
+	}
+
+	close(in)
+	if msg := <-rejected; msg != generic.T(1) {
+		t.Fatal("Invalid rejected message", msg)
+	}
+
+	if msg := <-rejected; msg != generic.T(3) {
+		t.Fatal("Invalid rejected message", msg)
+	}
+
+	var msgs []generic.T
+	for msg := range mb.ToChan(context.Background(), 0) {
+		msgs = append(msgs, msg)
+	}
+
+	if len(msgs) != 2 || msgs[0] != generic.T(2) || msgs[1] != generic.T(4) {
+		t.Fatal("Invalid messages", msgs)
+	}
+}
+
+func TestToChanCancel(t *testing.T) {
+	for _, sent := range []bool{false, true} {
+		mb := New(4)
+		if sent {
+			// Our feeder blocks on a channel which is never read
+			mb.Send(1, false)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		out := mb.ToChan(ctx, 0)
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+
+		select {
+		case _, ok := <-out:
+			if ok && !sent {
+				t.Fatal("Unexpected message received")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Channel was not closed after cancelling", sent)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Command mailbox-resp serves in-process mailboxes through a subset of the Redis
+// list commands (see the resp package), so that Redis clients in any language
+// can talk to them.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+
+	"github.com/itsmontoya/mailbox/resp"
+)
+
+func main() {
+	var (
+		addr string
+		size int
+	)
+
+	flag.StringVar(&addr, "addr", "127.0.0.1:6379", "address to listen on")
+	flag.IntVar(&size, "size", 1024, "size of mailboxes created on first use")
+	flag.Parse()
+
+	if size <= 0 {
+		log.Fatal("mailbox-resp: size must be greater than zero")
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("mailbox-resp: error listening: %v", err)
+	}
+
+	log.Printf("mailbox-resp: listening on %s", l.Addr())
+	if err = resp.NewServer(size).Serve(l); err != nil {
+		log.Fatalf("mailbox-resp: error serving: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Command mailboxd is a local broker which hosts named mailboxes for processes
+// on the same host. Clients attach to a mailbox by name over a Unix domain socket
+// using remote.DialUnix, mailboxes are created on first attach.
+//
+// Payloads are stored as opaque bytes, clients are free to pick their own codec
+// so long as all clients of a mailbox agree on it.
+//
+// On SIGINT or SIGTERM mailboxd closes its mailboxes and gives attached clients up
+// to -grace to receive the remaining messages, which are followed by StateClosed.
+// A mailbox which has been closed and drained is forgotten, attaching to its name
+// creates a new mailbox.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/itsmontoya/mailbox/remote"
+)
+
+func main() {
+	var (
+		socket string
+		size   int
+		grace  time.Duration
+	)
+
+	flag.StringVar(&socket, "socket", "/tmp/mailboxd.sock", "path of the Unix domain socket to listen on")
+	flag.IntVar(&size, "size", 1024, "size of mailboxes created on first attach")
+	flag.DurationVar(&grace, "grace", 10*time.Second, "time given to attached clients to drain their mailboxes on shutdown")
+	flag.Parse()
+
+	if size <= 0 {
+		log.Fatal("mailboxd: size must be greater than zero")
+	}
+
+	// Remove a socket left behind by a previous run
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("mailboxd: error removing stale socket: %v", err)
+	}
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		log.Fatalf("mailboxd: error listening: %v", err)
+	}
+
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, os.Interrupt, syscall.SIGTERM)
+	log.Printf("mailboxd: listening on %s", socket)
+	if err = run(l, size, grace, sc); err != nil {
+		log.Fatalf("mailboxd: %v", err)
+	}
+}
+
+// run will serve mailboxes on the provided listener until stop is notified. Our
+// mailboxes are then closed and attached clients are given up to grace to receive
+// the remaining messages, followed by StateClosed
+func run(l net.Listener, size int, grace time.Duration, stop <-chan os.Signal) (err error) {
+	srv := remote.NewServer(remote.RawCodec{})
+	srv.OnDemand(size)
+
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	select {
+	case err = <-served:
+		return fmt.Errorf("error serving: %w", err)
+	case <-stop:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err = srv.Shutdown(ctx); err != nil {
+		log.Printf("mailboxd: clients did not drain within %v, their connections were closed", grace)
+	}
+
+	if err = <-served; !errors.Is(err, remote.ErrServerClosed) {
+		return fmt.Errorf("error serving: %w", err)
+	}
+
+	return nil
+}
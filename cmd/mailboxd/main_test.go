@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+	"github.com/itsmontoya/mailbox/remote"
+)
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mailboxd.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() { done <- run(l, 4, time.Second, stop) }()
+
+	sender, err := remote.DialUnix(path, "jobs", remote.RawCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Disconnect()
+
+	receiver, err := remote.DialUnix(path, "jobs", remote.RawCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Disconnect()
+
+	for _, msg := range []string{"a", "b"} {
+		if state := sender.Send([]byte(msg), true); state != mailbox.StateOK {
+			t.Fatal("invalid state", state)
+		}
+	}
+
+	if msg, state := receiver.Receive(true); state != mailbox.StateOK || string(msg.([]byte)) != "a" {
+		t.Fatal("invalid receive", msg, state)
+	}
+
+	// Our queued message is still delivered once shutdown starts, followed by StateClosed
+	stop <- syscall.SIGTERM
+	if msg, state := receiver.Receive(true); state != mailbox.StateOK || string(msg.([]byte)) != "b" {
+		t.Fatal("invalid receive", msg, state)
+	}
+
+	if _, state := receiver.Receive(true); state != mailbox.StateClosed {
+		t.Fatal("invalid state", state)
+	}
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("mailboxd did not shut down")
+	}
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("socket was not removed", err)
+	}
+}
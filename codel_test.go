@@ -0,0 +1,98 @@
+package mailbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+func TestCoDel(t *testing.T) {
+	now := time.Unix(0, 0)
+	mb := NewWithOptions(16, Options{
+		Clock: func() time.Time { return now },
+		CoDel: &CoDel{},
+	})
+
+	for i := 0; i < 10; i++ {
+		mb.Send(i, false)
+	}
+
+	var msgs []generic.T
+	receive := func(n int) {
+		for i := 0; i < n; i++ {
+			msg, state := mb.Receive(false)
+			if state != StateOK {
+				t.Fatal("Invalid state code returned", state)
+			}
+
+			msgs = append(msgs, msg)
+		}
+	}
+
+	// Sojourn time is above target, but not yet for an entire interval
+	now = now.Add(50 * time.Millisecond)
+	receive(1)
+	// Sojourn time has been above target for an interval, the head is dropped
+	now = now.Add(150 * time.Millisecond)
+	receive(2)
+	// The next drop is an interval later
+	now = now.Add(100 * time.Millisecond)
+	receive(1)
+	// The last message is never dropped, and latency recovers once the mailbox is drained
+	receive(4)
+
+	expected := []generic.T{0, 2, 3, 5, 6, 7, 8, 9}
+	if len(msgs) != len(expected) {
+		t.Fatal("Invalid messages received", msgs)
+	}
+
+	for i, msg := range msgs {
+		if msg != expected[i] {
+			t.Fatal("Invalid messages received", msgs)
+		}
+	}
+
+	if s := mb.Stats(); s.Dropped != 2 || s.Len != 0 {
+		t.Fatal("Invalid stats", s.Dropped, s.Len)
+	}
+
+	if mb.codel.dropping {
+		t.Fatal("Expected to leave the dropping state")
+	}
+}
+
+func TestCoDelReject(t *testing.T) {
+	now := time.Unix(0, 0)
+	mb := NewWithOptions(16, Options{
+		Clock: func() time.Time { return now },
+		CoDel: &CoDel{Reject: true},
+	})
+
+	for i := 0; i < 4; i++ {
+		mb.Send(i, false)
+	}
+
+	now = now.Add(50 * time.Millisecond)
+	mb.Receive(false)
+	now = now.Add(150 * time.Millisecond)
+	if msg, _ := mb.Receive(false); msg != generic.T(1) {
+		t.Fatal("Messages should not be dropped when rejecting", msg)
+	}
+
+	if state := mb.Send(4, false); state != StateShed {
+		t.Fatal("Expected send to be shed", state)
+	}
+
+	if state := mb.Send(4, true); state != StateOK {
+		t.Fatal("Invalid state code returned", state)
+	}
+
+	if sent, state := mb.BatchN([]generic.T{5, 6}, BatchAtomic); sent != 2 || state != StateOK {
+		t.Fatal("Invalid batch result", sent, state)
+	}
+
+	if s := mb.Stats(); s.Shed != 1 || s.Dropped != 0 || s.Len != 5 {
+		t.Fatal("Invalid stats", s.Shed, s.Dropped, s.Len)
+	}
+}
@@ -0,0 +1,23 @@
+package mailbox
+
+import (
+	"testing"
+
+	"github.com/itsmontoya/mailbox/mailboxtest"
+	"github.com/joeshaw/gengen/generic"
+)
+
+func TestConformance(t *testing.T) {
+	mailboxtest.Run(t, mailboxtest.Factory[generic.T, StateCode]{
+		New: func(sz int) mailboxtest.Mailbox[generic.T, StateCode] { return New(sz) },
+		States: mailboxtest.States[StateCode]{
+			OK:     StateOK,
+			Empty:  StateEmpty,
+			Full:   StateFull,
+			Ended:  StateEnded,
+			Closed: StateClosed,
+		},
+		Message: func(i int) generic.T { return i },
+		Index:   func(msg generic.T) int { return msg.(int) },
+	})
+}
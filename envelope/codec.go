@@ -0,0 +1,42 @@
+package envelope
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+// ErrInvalidMessage is returned when a message which isn't an envelope is marshaled
+var ErrInvalidMessage = errors.New("envelope: invalid message")
+
+// Codec encodes envelopes of T along with all of their metadata using encoding/gob.
+// It satisfies remote.Codec, so envelopes may cross the wire, and its bytes may be
+// stored by any layer which persists []byte messages (e.g. a shm ring)
+type Codec[T any] struct{}
+
+// Marshal will encode an envelope, the message must be a *Envelope[T]
+func (Codec[T]) Marshal(msg generic.T) (b []byte, err error) {
+	e, ok := msg.(*Envelope[T])
+	if !ok {
+		return nil, ErrInvalidMessage
+	}
+
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(e); err != nil {
+		return
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal will decode an envelope
+func (Codec[T]) Unmarshal(b []byte) (msg generic.T, err error) {
+	var e Envelope[T]
+	if err = gob.NewDecoder(bytes.NewReader(b)).Decode(&e); err != nil {
+		return
+	}
+
+	return &e, nil
+}
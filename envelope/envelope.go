@@ -0,0 +1,137 @@
+// Package envelope wraps mailbox messages with metadata: a unique ID, headers,
+// timestamps, a delivery count and a correlation ID.
+//
+//	mb := envelope.NewMailbox[Job](32, mailbox.Options{})
+//	env := envelope.New(job)
+//	env.Set("tenant", "acme")
+//	mb.Send(env, true)
+//
+//	env, state := mb.Receive(true)
+//
+// Envelopes are plain messages, so they flow through any mailbox.Interface
+// (including remote clients) and any layer which accepts a mailbox message.
+// The Enqueued timestamp and the delivery count are maintained by the mailbox
+// hooks returned by Hooks, which NewMailbox installs. SendCtx and ListenCtx carry
+// the trace context of the sender through the headers, restoring it as the context
+// of the receiver (See Propagator).
+package envelope
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+	"github.com/joeshaw/gengen/generic"
+)
+
+// New returns a new envelope for the provided body with a unique ID
+func New[T any](body T) *Envelope[T] {
+	return &Envelope[T]{
+		ID:      NewID(),
+		Created: time.Now(),
+		Body:    body,
+	}
+}
+
+// Reply returns a new envelope for the provided body, correlated to the provided request
+func Reply[R, T any](req *Envelope[T], body R) *Envelope[R] {
+	e := New(body)
+	e.CorrelationID = req.ID
+	return e
+}
+
+// NewID returns a new random 128-bit ID, hex encoded
+func NewID() string {
+	var b [16]byte
+	// Note: crypto/rand.Read never returns an error
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Envelope is a message body along with its metadata
+type Envelope[T any] struct {
+	// ID is the unique ID of the message
+	ID string
+	// CorrelationID is the ID of the message this message relates to (e.g. the request of a reply)
+	CorrelationID string
+	// Headers are arbitrary key/value pairs, such as trace context or tenant IDs
+	Headers map[string]string
+
+	// Created is the time the envelope was created
+	Created time.Time
+	// Enqueued is the time the envelope was last added to a mailbox
+	Enqueued time.Time
+	// Deliveries is the number of times the envelope has been received
+	Deliveries int
+
+	// Body is the message itself
+	Body T
+}
+
+// Get will return the value of the provided header, or an empty string when not set
+func (e *Envelope[T]) Get(key string) string {
+	return e.Headers[key]
+}
+
+// Set will set the value of the provided header
+func (e *Envelope[T]) Set(key, value string) {
+	if e.Headers == nil {
+		e.Headers = make(map[string]string)
+	}
+
+	e.Headers[key] = value
+}
+
+// Delete will remove the provided header
+func (e *Envelope[T]) Delete(key string) {
+	delete(e.Headers, key)
+}
+
+func (e *Envelope[T]) enqueue(t time.Time) {
+	e.Enqueued = t
+}
+
+func (e *Envelope[T]) deliver() {
+	e.Deliveries++
+}
+
+// tracked is implemented by envelopes of every body type
+type tracked interface {
+	enqueue(t time.Time)
+	deliver()
+}
+
+// Hooks returns mailbox hooks which stamp the Enqueued time of envelopes as they
+// are sent and count their deliveries as they are received, before calling the
+// provided hooks. Messages which are not envelopes are left untouched. The clock
+// is used for the Enqueued time, time.Now is used when nil.
+// Note: Hooks run under the mailbox lock, so envelopes are updated before any receiver sees them
+func Hooks(h mailbox.Hooks, clock func() time.Time) mailbox.Hooks {
+	if clock == nil {
+		clock = time.Now
+	}
+
+	onSend, onReceive := h.OnSend, h.OnReceive
+	h.OnSend = func(msg generic.T) {
+		if e, ok := msg.(tracked); ok {
+			e.enqueue(clock())
+		}
+
+		if onSend != nil {
+			onSend(msg)
+		}
+	}
+
+	h.OnReceive = func(msg generic.T) {
+		if e, ok := msg.(tracked); ok {
+			e.deliver()
+		}
+
+		if onReceive != nil {
+			onReceive(msg)
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,80 @@
+package envelope
+
+import (
+	"testing"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+type job struct {
+	Name string
+}
+
+func TestEnvelope(t *testing.T) {
+	now := time.Unix(100, 0)
+	mb := NewMailbox[job](4, mailbox.Options{
+		Clock: func() time.Time { return now },
+	})
+
+	e := New(job{Name: "a"})
+	e.Set("tenant", "acme")
+	if state := mb.Send(e, false); state != mailbox.StateOK {
+		t.Fatal("Invalid state code returned", state)
+	}
+
+	r, state := mb.Receive(false)
+	if state != mailbox.StateOK || r != e {
+		t.Fatal("Invalid envelope received", r, state)
+	}
+
+	if !r.Enqueued.Equal(now) || r.Deliveries != 1 || r.Get("tenant") != "acme" || r.Body.Name != "a" {
+		t.Fatal("Invalid envelope", r)
+	}
+
+	// Redelivering the envelope increments its delivery count
+	now = now.Add(time.Second)
+	mb.Send(r, false)
+	mb.Close()
+	mb.Listen(func(r *Envelope[job]) (end bool) {
+		if !r.Enqueued.Equal(now) || r.Deliveries != 2 {
+			t.Fatal("Invalid envelope", r)
+		}
+
+		return
+	})
+}
+
+func TestReply(t *testing.T) {
+	req := New(job{Name: "a"})
+	rep := Reply(req, 42)
+	if rep.CorrelationID != req.ID || rep.ID == req.ID || rep.Body != 42 {
+		t.Fatal("Invalid reply", rep)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	var c Codec[job]
+	e := New(job{Name: "a"})
+	e.Set("traceparent", "00-abc-def-01")
+	e.Deliveries = 3
+
+	b, err := c.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := c.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := msg.(*Envelope[job])
+	if d.ID != e.ID || d.Get("traceparent") != e.Get("traceparent") || d.Deliveries != 3 || !d.Created.Equal(e.Created) || d.Body != e.Body {
+		t.Fatal("Invalid decoded envelope", d)
+	}
+
+	if _, err = c.Marshal(job{}); err != ErrInvalidMessage {
+		t.Fatal("Expected ErrInvalidMessage", err)
+	}
+}
@@ -0,0 +1,70 @@
+package envelope
+
+import (
+	"github.com/itsmontoya/mailbox"
+	"github.com/joeshaw/gengen/generic"
+)
+
+// NewMailbox returns a new mailbox of envelopes, the envelope hooks are installed
+// in front of any hooks within the provided options
+func NewMailbox[T any](sz int, opts mailbox.Options) *Mailbox[T] {
+	opts.Hooks = Hooks(opts.Hooks, opts.Clock)
+	return Wrap[T](mailbox.NewWithOptions(sz, opts))
+}
+
+// Wrap returns a mailbox of envelopes backed by the provided mailbox, which may be
+// local or remote. Messages which are not envelopes of T are received as nil
+// Note: Enqueued times and delivery counts are only maintained when the backing
+// mailbox has the envelope hooks installed (See Hooks)
+func Wrap[T any](mb mailbox.Interface) *Mailbox[T] {
+	return &Mailbox[T]{mb: mb}
+}
+
+// Mailbox is a typed mailbox of envelopes
+type Mailbox[T any] struct {
+	mb mailbox.Interface
+	// prop is the propagator of trace context, TraceContext is used when nil
+	prop Propagator
+}
+
+// Send will send an envelope
+func (m *Mailbox[T]) Send(e *Envelope[T], wait bool) (state mailbox.StateCode) {
+	return m.mb.Send(e, wait)
+}
+
+// Batch will send a batch of envelopes
+func (m *Mailbox[T]) Batch(es ...*Envelope[T]) {
+	msgs := make([]generic.T, len(es))
+	for i, e := range es {
+		msgs[i] = e
+	}
+
+	m.mb.Batch(msgs...)
+}
+
+// Receive will receive an envelope and state
+func (m *Mailbox[T]) Receive(wait bool) (e *Envelope[T], state mailbox.StateCode) {
+	var msg generic.T
+	msg, state = m.mb.Receive(wait)
+	e, _ = msg.(*Envelope[T])
+	return
+}
+
+// Listen will provide all current and inbound envelopes until the mailbox is
+// empty and closed, or end is returned (See mailbox.Mailbox.Listen)
+func (m *Mailbox[T]) Listen(fn func(e *Envelope[T]) (end bool)) (state mailbox.StateCode) {
+	return m.mb.Listen(func(msg generic.T) (end bool) {
+		e, _ := msg.(*Envelope[T])
+		return fn(e)
+	})
+}
+
+// Close will close the mailbox
+func (m *Mailbox[T]) Close() {
+	m.mb.Close()
+}
+
+// Mailbox will return the backing mailbox
+func (m *Mailbox[T]) Mailbox() mailbox.Interface {
+	return m.mb
+}
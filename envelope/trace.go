@@ -0,0 +1,212 @@
+package envelope
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	"github.com/itsmontoya/mailbox"
+	"github.com/joeshaw/gengen/generic"
+)
+
+// Carrier is a set of headers a Propagator reads and writes, Envelope is a Carrier
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+	Keys() []string
+}
+
+// Propagator injects trace context from a context.Context into headers, and
+// extracts it from headers into a context.Context. It mirrors the shape of the
+// OpenTelemetry TextMapPropagator, so one can be adapted with a few lines.
+type Propagator interface {
+	Inject(ctx context.Context, c Carrier)
+	Extract(ctx context.Context, c Carrier) context.Context
+}
+
+// Keys will return the header keys of the envelope
+func (e *Envelope[T]) Keys() (keys []string) {
+	keys = make([]string, 0, len(e.Headers))
+	for key := range e.Headers {
+		keys = append(keys, key)
+	}
+
+	return
+}
+
+// SpanContext identifies a span of a distributed trace (See W3C Trace Context)
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	// Flags are the trace flags, 1 is sampled
+	Flags byte
+	// TraceState is the vendor specific trace state, carried as is
+	TraceState string
+}
+
+// IsValid will return whether or not the span context has both a trace and span ID
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying the provided span context
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, if any
+func SpanContextFromContext(ctx context.Context) (sc SpanContext, ok bool) {
+	sc, ok = ctx.Value(spanContextKey{}).(SpanContext)
+	return
+}
+
+// TraceContext is a Propagator of the W3C Trace Context traceparent and tracestate
+// headers, for span contexts carried with ContextWithSpanContext
+type TraceContext struct{}
+
+const (
+	traceparent = "traceparent"
+	tracestate  = "tracestate"
+)
+
+// deleter is implemented by carriers which can remove headers, Envelope is a deleter
+type deleter interface {
+	Delete(key string)
+}
+
+// Inject will set the traceparent (and tracestate) headers from the span context of ctx.
+// When ctx carries no valid span context, existing headers are removed so that a
+// re-sent envelope does not carry a stale trace context
+func (TraceContext) Inject(ctx context.Context, c Carrier) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok || !sc.IsValid() {
+		unset(c, traceparent)
+		unset(c, tracestate)
+		return
+	}
+
+	c.Set(traceparent, "00-"+hex.EncodeToString(sc.TraceID[:])+"-"+hex.EncodeToString(sc.SpanID[:])+"-"+hex.EncodeToString([]byte{sc.Flags}))
+	if sc.TraceState == "" {
+		unset(c, tracestate)
+		return
+	}
+
+	c.Set(tracestate, sc.TraceState)
+}
+
+// unset will remove the provided header, carriers which cannot remove headers have it set empty
+func unset(c Carrier, key string) {
+	if d, ok := c.(deleter); ok {
+		d.Delete(key)
+		return
+	}
+
+	if c.Get(key) != "" {
+		c.Set(key, "")
+	}
+}
+
+// Extract will return a copy of ctx carrying the span context of the traceparent
+// header, ctx is returned as is when the header is missing or invalid
+func (TraceContext) Extract(ctx context.Context, c Carrier) context.Context {
+	var sc SpanContext
+	// Format is version-traceid-spanid-flags, e.g. 00-<32 hex>-<16 hex>-01
+	parts := strings.Split(c.Get(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ctx
+	}
+
+	flags := make([]byte, 1)
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags, parts[3]) || !sc.IsValid() {
+		return ctx
+	}
+
+	sc.Flags = flags[0]
+	sc.TraceState = c.Get(tracestate)
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// decodeHex will decode s into dst, returning false unless s is exactly the hex encoding of len(dst) bytes
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) {
+		return false
+	}
+
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// ctxMailbox is implemented by mailboxes which label blocked waits (See mailbox.Mailbox.SendCtx)
+type ctxMailbox interface {
+	SendCtx(ctx context.Context, msg generic.T, wait bool) mailbox.StateCode
+	ReceiveCtx(ctx context.Context, wait bool) (generic.T, mailbox.StateCode)
+}
+
+// SetPropagator will set the propagator used by SendCtx, ReceiveCtx and ListenCtx,
+// TraceContext is used by default
+func (m *Mailbox[T]) SetPropagator(p Propagator) {
+	m.prop = p
+}
+
+func (m *Mailbox[T]) propagator() Propagator {
+	if m.prop == nil {
+		return TraceContext{}
+	}
+
+	return m.prop
+}
+
+// SendCtx will inject the trace context of ctx into the headers of the envelope and send it
+func (m *Mailbox[T]) SendCtx(ctx context.Context, e *Envelope[T], wait bool) (state mailbox.StateCode) {
+	m.propagator().Inject(ctx, e)
+	if cm, ok := m.mb.(ctxMailbox); ok {
+		return cm.SendCtx(ctx, e, wait)
+	}
+
+	return m.mb.Send(e, wait)
+}
+
+// ReceiveCtx will receive an envelope along with a copy of ctx carrying the trace
+// context of the envelope headers
+func (m *Mailbox[T]) ReceiveCtx(ctx context.Context, wait bool) (rctx context.Context, e *Envelope[T], state mailbox.StateCode) {
+	var msg generic.T
+	if cm, ok := m.mb.(ctxMailbox); ok {
+		msg, state = cm.ReceiveCtx(ctx, wait)
+	} else {
+		msg, state = m.mb.Receive(wait)
+	}
+
+	rctx = ctx
+	if e, _ = msg.(*Envelope[T]); e != nil {
+		rctx = m.propagator().Extract(ctx, e)
+	}
+
+	return
+}
+
+// ListenCtx will provide all current and inbound envelopes along with the restored
+// trace context of the sender, derived from ctx. Unlike Listen, the mailbox lock is
+// not held while fn runs
+func (m *Mailbox[T]) ListenCtx(ctx context.Context, fn func(ctx context.Context, e *Envelope[T]) (end bool)) (state mailbox.StateCode) {
+	var (
+		rctx context.Context
+		e    *Envelope[T]
+	)
+
+	for {
+		if rctx, e, state = m.ReceiveCtx(ctx, true); state != mailbox.StateOK {
+			// Receiving was not successful, break
+			break
+		}
+
+		if fn(rctx, e) {
+			// End was returned as true, set state accordingly and break
+			state = mailbox.StateEnded
+			break
+		}
+	}
+
+	return
+}
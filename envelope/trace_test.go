@@ -0,0 +1,77 @@
+package envelope
+
+import (
+	"context"
+	"testing"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+func TestTraceContext(t *testing.T) {
+	sc := SpanContext{
+		TraceID:    [16]byte{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     [8]byte{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Flags:      1,
+		TraceState: "vendor=value",
+	}
+
+	mb := NewMailbox[string](4, mailbox.Options{})
+	mb.SendCtx(ContextWithSpanContext(context.Background(), sc), New("a"), false)
+	mb.Send(New("b"), false)
+	mb.Close()
+
+	var n int
+	state := mb.ListenCtx(context.Background(), func(ctx context.Context, e *Envelope[string]) (end bool) {
+		got, ok := SpanContextFromContext(ctx)
+		switch n++; e.Body {
+		case "a":
+			if e.Get("traceparent") != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+				t.Fatal("invalid traceparent", e.Get("traceparent"))
+			}
+
+			if !ok || got != sc {
+				t.Fatal("span context was not restored", got)
+			}
+
+		case "b":
+			if ok {
+				t.Fatal("unexpected span context", got)
+			}
+		}
+
+		return
+	})
+
+	if state != mailbox.StateClosed || n != 2 {
+		t.Fatal("invalid listen", state, n)
+	}
+}
+
+func TestTraceContextStale(t *testing.T) {
+	e := New(0)
+	e.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.Set("tracestate", "vendor=value")
+
+	// Injecting a context without a span removes the trace context of a previous send
+	TraceContext{}.Inject(context.Background(), e)
+	if len(e.Headers) != 0 {
+		t.Fatal("expected stale trace headers to be removed", e.Headers)
+	}
+}
+
+func TestTraceContextInvalid(t *testing.T) {
+	for _, tp := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902zz-01",
+	} {
+		e := New(0)
+		e.Set("traceparent", tp)
+		if _, ok := SpanContextFromContext(TraceContext{}.Extract(context.Background(), e)); ok {
+			t.Fatal("expected invalid traceparent to be ignored", tp)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package mailbox
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+// Fuzz operations, the low three bits of each byte select the operation and the
+// remaining bits are its argument
+const (
+	fuzzSend = iota
+	fuzzBatch
+	fuzzReceive
+	fuzzClose
+	fuzzListen
+	fuzzPop
+	fuzzReceiveWait
+	fuzzSendWait
+)
+
+// fuzzModel is the reference implementation, a slice of the messages in the mailbox
+type fuzzModel struct {
+	cap    int
+	q      []int
+	closed bool
+	next   int
+}
+
+// msg will return the next message to send
+func (f *fuzzModel) msg() int {
+	f.next++
+	return f.next
+}
+
+func (f *fuzzModel) room() int {
+	return f.cap - len(f.q)
+}
+
+// FuzzMailbox decodes its input into a sequence of operations and checks every result
+// against a slice. The first byte is the mailbox size, so that sizes as small as 1 are
+// covered. Operations which would block are only performed when the model knows they
+// return immediately, e.g. a waiting receive is only issued when a message is queued
+func FuzzMailbox(f *testing.F) {
+	f.Add([]byte{0, fuzzSend, fuzzSend, fuzzReceive, fuzzReceive, fuzzClose, fuzzReceive})
+	f.Add([]byte{0, fuzzPop, fuzzPop, fuzzPop, fuzzReceive, fuzzReceive})
+	f.Add([]byte{2, fuzzBatch | 2<<3, fuzzPop, fuzzReceive, fuzzBatch | 3<<3, fuzzListen | 1<<3, fuzzClose, fuzzListen})
+	f.Add([]byte{3, fuzzSend, fuzzSendWait, fuzzReceiveWait, fuzzBatch | 7<<3, fuzzPop, fuzzPop, fuzzListen | 2<<3, fuzzClose, fuzzReceiveWait})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		if len(ops) == 0 {
+			return
+		}
+
+		m := fuzzModel{cap: 1 + int(ops[0]%8)}
+		mb := New(m.cap)
+		for i, b := range ops[1:] {
+			op, arg := b&7, int(b>>3)
+			switch op {
+			case fuzzSend:
+				fuzzSendOp(t, mb, &m, false)
+			case fuzzSendWait:
+				if len(m.q) == m.cap && !m.closed {
+					// Our send would block
+					continue
+				}
+
+				fuzzSendOp(t, mb, &m, true)
+			case fuzzBatch:
+				fuzzBatchOp(t, mb, &m, 1+arg%8)
+			case fuzzReceive:
+				fuzzReceiveOp(t, mb, &m, false)
+			case fuzzReceiveWait:
+				if len(m.q) == 0 && !m.closed {
+					// Our receive would block
+					continue
+				}
+
+				fuzzReceiveOp(t, mb, &m, true)
+			case fuzzClose:
+				mb.Close()
+				m.closed = true
+			case fuzzListen:
+				fuzzListenOp(t, mb, &m, 1+arg)
+			case fuzzPop:
+				if m.closed {
+					// Overwriting is only reached through sends, which are refused once closed
+					continue
+				}
+
+				msg := m.msg()
+				mb.mux.Lock()
+				mb.pop(msg)
+				mb.mux.Unlock()
+				if len(m.q) == m.cap {
+					m.q = m.q[1:]
+				}
+
+				m.q = append(m.q, msg)
+			}
+
+			if n := mb.Len(); n != len(m.q) {
+				t.Fatalf("Invalid length after operation %d (%d): expected %d and received %d", i, op, len(m.q), n)
+			}
+		}
+
+		// Drain the mailbox, it must hold exactly the messages of our model
+		var msgs []int
+		for {
+			msg, state := mb.Receive(false)
+			if state != StateOK {
+				break
+			}
+
+			msgs = append(msgs, msg.(int))
+		}
+
+		if !slices.Equal(msgs, m.q) {
+			t.Fatalf("Invalid messages: expected %v and received %v", m.q, msgs)
+		}
+	})
+}
+
+func fuzzSendOp(t *testing.T, mb *Mailbox, m *fuzzModel, wait bool) {
+	expected := StateOK
+	switch {
+	case m.closed:
+		expected = StateClosed
+	case len(m.q) == m.cap:
+		expected = StateFull
+	}
+
+	msg := m.msg()
+	if state := mb.Send(msg, wait); state != expected {
+		t.Fatalf("Invalid send state: expected %v and received %v", expected, state)
+	}
+
+	if expected == StateOK {
+		m.q = append(m.q, msg)
+	}
+}
+
+// fuzzBatchOp will send a batch of n messages. A batch which fits is sent with Batch
+// or an atomic BatchN, others with the modes of BatchN which do not block
+func fuzzBatchOp(t *testing.T, mb *Mailbox, m *fuzzModel, n int) {
+	msgs := make([]generic.T, n)
+	ints := make([]int, n)
+	for i := range msgs {
+		ints[i] = m.msg()
+		msgs[i] = ints[i]
+	}
+
+	switch {
+	case m.closed:
+		if sent, state := mb.BatchN(msgs, BatchNoWait); sent != 0 || state != StateClosed {
+			t.Fatalf("Invalid batch result for a closed mailbox: %d, %v", sent, state)
+		}
+
+	case n <= m.room() && n%2 == 0:
+		mb.Batch(msgs...)
+		m.q = append(m.q, ints...)
+
+	case n <= m.room():
+		if sent, state := mb.BatchN(msgs, BatchAtomic); sent != n || state != StateOK {
+			t.Fatalf("Invalid atomic batch result: %d, %v", sent, state)
+		}
+
+		m.q = append(m.q, ints...)
+
+	case n > m.cap:
+		// An atomic batch which can never fit is refused without waiting
+		if sent, state := mb.BatchN(msgs, BatchAtomic); sent != 0 || state != StateFull {
+			t.Fatalf("Invalid atomic batch result: %d, %v", sent, state)
+		}
+
+	default:
+		room := m.room()
+		if sent, state := mb.BatchN(msgs, BatchNoWait); sent != room || state != StateFull {
+			t.Fatalf("Invalid batch result: expected %d sent and received %d, %v", room, sent, state)
+		}
+
+		m.q = append(m.q, ints[:room]...)
+	}
+}
+
+func fuzzReceiveOp(t *testing.T, mb *Mailbox, m *fuzzModel, wait bool) {
+	msg, state := mb.Receive(wait)
+	switch {
+	case len(m.q) > 0:
+		if state != StateOK || msg != m.q[0] {
+			t.Fatalf("Invalid receive: expected %d and received %v, %v", m.q[0], msg, state)
+		}
+
+		m.q = m.q[1:]
+	case m.closed:
+		if state != StateClosed {
+			t.Fatalf("Invalid receive state for a closed mailbox: %v", state)
+		}
+
+	default:
+		if state != StateEmpty {
+			t.Fatalf("Invalid receive state for an empty mailbox: %v", state)
+		}
+	}
+}
+
+// fuzzListenOp will listen until n messages are received, it is only performed when
+// the listen cannot block: either n messages are queued or the mailbox is closed
+func fuzzListenOp(t *testing.T, mb *Mailbox, m *fuzzModel, n int) {
+	if len(m.q) < n && !m.closed {
+		return
+	}
+
+	var received []int
+	state := mb.Listen(func(msg generic.T) (end bool) {
+		received = append(received, msg.(int))
+		return len(received) == n
+	})
+
+	expected := StateEnded
+	if len(m.q) < n {
+		// Our mailbox is closed, it is drained before the listen returns
+		expected, n = StateClosed, len(m.q)
+	}
+
+	if state != expected || !slices.Equal(received, m.q[:n]) {
+		t.Fatalf("Invalid listen: expected %v, %v and received %v, %v", m.q[:n], expected, received, state)
+	}
+
+	m.q = m.q[n:]
+}
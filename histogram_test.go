@@ -0,0 +1,107 @@
+package mailbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	if h.Count() != 100 || h.Min() != time.Millisecond || h.Max() != 100*time.Millisecond {
+		t.Fatal("invalid histogram", h.Count(), h.Min(), h.Max())
+	}
+
+	if h.Mean() != 50500*time.Microsecond {
+		t.Fatal("invalid mean", h.Mean())
+	}
+
+	for _, c := range []struct {
+		q        float64
+		expected time.Duration
+	}{
+		{0.5, 50 * time.Millisecond},
+		{0.9, 90 * time.Millisecond},
+		{0.99, 99 * time.Millisecond},
+		{1, 100 * time.Millisecond},
+	} {
+		// Buckets are within 12.5% of the values they hold
+		if d := h.Quantile(c.q); d < c.expected || d > c.expected+c.expected/8 {
+			t.Fatal("invalid quantile", c.q, d)
+		}
+	}
+
+	var cnt uint64
+	last := time.Duration(-1)
+	h.ForEach(func(lower, upper time.Duration, n uint64) (end bool) {
+		if lower <= last || upper < lower {
+			t.Fatal("buckets are not ascending", last, lower, upper)
+		}
+
+		last = upper
+		cnt += n
+		return
+	})
+
+	if cnt != h.Count() {
+		t.Fatal("invalid bucket count", cnt)
+	}
+}
+
+func TestHistogramIndex(t *testing.T) {
+	// Every value must fall within the bounds of its bucket
+	for _, v := range []uint64{0, 1, 15, 16, 17, 31, 32, 1000, 123456789, 1<<63 - 1} {
+		i := histIndex(v)
+		if i < 0 || i >= histBuckets {
+			t.Fatal("index out of range", v, i)
+		}
+
+		if v > histUpper(i) || v < histLower(i) || (i > 0 && v <= histUpper(i-1)) {
+			t.Fatal("value outside of bucket", v, i, histLower(i), histUpper(i))
+		}
+	}
+}
+
+func TestSojourn(t *testing.T) {
+	now := time.Unix(0, 0)
+	mb := NewWithOptions(4, Options{
+		TrackSojourn: true,
+		Clock:        func() time.Time { return now },
+	})
+
+	mb.Send(1, false)
+	now = now.Add(time.Second)
+	mb.Send(2, false)
+	now = now.Add(time.Second)
+
+	if _, age, _ := mb.ReceiveAge(false); age != 2*time.Second {
+		t.Fatal("invalid age", age)
+	}
+
+	mb.Close()
+	mb.ListenAge(func(_ generic.T, age time.Duration) (end bool) {
+		if age != time.Second {
+			t.Fatal("invalid age", age)
+		}
+
+		return
+	})
+
+	s := mb.Stats().Sojourn
+	if s.Count() != 2 || s.Min() != time.Second || s.Max() != 2*time.Second {
+		t.Fatal("invalid sojourn histogram", s.Count(), s.Min(), s.Max())
+	}
+
+	// Ages are not tracked by default
+	mb = New(1)
+	mb.Send(1, false)
+	_, age, _ := mb.ReceiveAge(false)
+	if s = mb.Stats().Sojourn; age != 0 || s.Count() != 0 {
+		t.Fatal("untracked mailbox reported an age", age)
+	}
+}
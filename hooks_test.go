@@ -0,0 +1,61 @@
+package mailbox
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+func TestHooks(t *testing.T) {
+	var (
+		mb     *Mailbox
+		events []string
+		closed = make(chan struct{})
+	)
+
+	record := func(name string) func(generic.T) {
+		return func(msg generic.T) {
+			events = append(events, name+":"+strconv.Itoa(msg.(int)))
+		}
+	}
+
+	mb = NewWithOptions(2, Options{
+		Hooks: Hooks{
+			OnSend:    record("send"),
+			OnReceive: record("receive"),
+			OnDrop:    record("drop"),
+			OnFull:    func() { events = append(events, "full") },
+			OnEmpty:   func() { events = append(events, "empty") },
+			OnClose: func() {
+				// OnClose runs outside of the lock, calling into the mailbox is allowed
+				if mb.Len() != 1 {
+					t.Error("Invalid length", mb.Len())
+				}
+
+				close(closed)
+			},
+		},
+	})
+
+	mb.Receive(false)
+	mb.Send(1, false)
+	mb.Send(2, false)
+	mb.Send(3, false)
+	mb.pop(3)
+	mb.Receive(false)
+
+	expected := []string{"empty", "send:1", "send:2", "full", "drop:1", "send:3", "receive:2"}
+	if len(events) != len(expected) {
+		t.Fatal("Invalid events", events)
+	}
+
+	for i, event := range events {
+		if event != expected[i] {
+			t.Fatal("Invalid events", events)
+		}
+	}
+
+	mb.Close()
+	<-closed
+}
@@ -0,0 +1,211 @@
+package mailbox
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+// double is a send interceptor which doubles every message
+func double(next SendFunc) SendFunc {
+	return func(msg generic.T, wait bool) StateCode {
+		return next(msg.(int)*2, wait)
+	}
+}
+
+// rejectOdd is a send interceptor which vetoes odd messages
+func rejectOdd(next SendFunc) SendFunc {
+	return func(msg generic.T, wait bool) StateCode {
+		if msg.(int)%2 != 0 {
+			return StateRejected
+		}
+
+		return next(msg, wait)
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	var order []string
+	trace := func(name string) ReceiveInterceptor {
+		return func(next ReceiveFunc) ReceiveFunc {
+			return func(wait bool) (generic.T, StateCode) {
+				order = append(order, name)
+				return next(wait)
+			}
+		}
+	}
+
+	mb := NewWithOptions(4, Options{
+		// The first interceptor is the outermost, odd messages are rejected before being doubled
+		SendInterceptors:    []SendInterceptor{rejectOdd, double},
+		ReceiveInterceptors: []ReceiveInterceptor{trace("a"), trace("b")},
+	})
+
+	if state := mb.Send(1, false); state != StateRejected {
+		t.Fatal("Expected odd message to be rejected", state)
+	}
+
+	if sent, state := mb.BatchN([]generic.T{2, 4}, BatchNoWait); sent != 2 || state != StateOK {
+		t.Fatal("Invalid batch result", sent, state)
+	}
+
+	// A vetoed message doesn't stop the rest of the batch
+	if sent, state := mb.BatchN([]generic.T{3, 6}, BatchWait); sent != 1 || state != StateOK {
+		t.Fatal("Invalid batch result", sent, state)
+	}
+
+	if sent, state := mb.BatchN([]generic.T{6, 7}, BatchAtomic); sent != 0 || state != StateRejected {
+		t.Fatal("Expected atomic batch to be rejected as a whole", sent, state)
+	}
+
+	if mb.Len() != 3 {
+		t.Fatal("Invalid length", mb.Len())
+	}
+
+	mb.Close()
+	var msgs []generic.T
+	state := mb.Listen(func(msg generic.T) (end bool) {
+		msgs = append(msgs, msg)
+		return
+	})
+
+	if state != StateClosed || fmt.Sprint(msgs) != "[4 8 12]" {
+		t.Fatal("Invalid messages received", msgs, state)
+	}
+
+	// Three receives and the final closed receive, each going through a then b
+	if fmt.Sprint(order) != "[a b a b a b a b]" {
+		t.Fatal("Invalid interceptor order", order)
+	}
+}
+
+func TestInterceptorsAtomic(t *testing.T) {
+	var states []StateCode
+	mb := NewWithOptions(2, Options{
+		SendInterceptors: []SendInterceptor{
+			ObserveSend(func(_ generic.T, state StateCode, _ time.Duration) {
+				states = append(states, state)
+			}),
+			rejectOdd,
+		},
+	})
+
+	// Every message of the batch observes the outcome of the whole batch
+	if sent, state := mb.BatchN([]generic.T{2, 4, 6}, BatchAtomic); sent != 0 || state != StateFull {
+		t.Fatal("Expected oversized batch to be full", sent, state)
+	}
+
+	if fmt.Sprint(states) != fmt.Sprint([]StateCode{StateFull, StateFull, StateFull}) {
+		t.Fatal("Invalid observed states", states)
+	}
+
+	states = nil
+	if sent, state := mb.BatchN([]generic.T{2, 4}, BatchAtomic); sent != 2 || state != StateOK {
+		t.Fatal("Invalid batch result", sent, state)
+	}
+
+	if fmt.Sprint(states) != fmt.Sprint([]StateCode{StateOK, StateOK}) {
+		t.Fatal("Invalid observed states", states)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var recovered any
+	mb := NewWithOptions(1, Options{
+		SendInterceptors: []SendInterceptor{
+			RecoverSend(func(v any) { recovered = v }),
+			func(next SendFunc) SendFunc {
+				return func(msg generic.T, wait bool) StateCode {
+					panic("invalid message")
+				}
+			},
+		},
+	})
+
+	if state := mb.Send(1, false); state != StateRejected || recovered != "invalid message" {
+		t.Fatal("Expected panic to be recovered", state, recovered)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	mb := NewWithOptions(8, Options{
+		SendInterceptors: []SendInterceptor{RateLimit(100, 2)},
+	})
+
+	mb.Send(1, false)
+	mb.Send(2, false)
+	if state := mb.Send(3, false); state != StateShed {
+		t.Fatal("Expected send over the limit to be shed", state)
+	}
+
+	// A waiting send waits for its turn
+	start := time.Now()
+	if state := mb.Send(3, true); state != StateOK {
+		t.Fatal("Invalid state code returned", state)
+	}
+
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatal("Expected send to wait for the limit", elapsed)
+	}
+
+	if stats := mb.Stats(); stats.Shed != 1 {
+		t.Fatal("Expected shed send to be counted", stats.Shed)
+	}
+}
+
+func TestRateLimitClose(t *testing.T) {
+	mb := NewWithOptions(8, Options{
+		SendInterceptors: []SendInterceptor{RateLimit(0.01, 1)},
+	})
+
+	mb.Send(1, false)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mb.Close()
+	}()
+
+	// A send waiting for its turn returns once the mailbox is closed
+	start := time.Now()
+	if state := mb.Send(2, true); state != StateClosed {
+		t.Fatal("Invalid state code returned", state)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatal("Expected send to stop waiting on close", elapsed)
+	}
+}
+
+func TestRateLimitInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		rate  float64
+		burst int
+	}{{0, 1}, {-1, 1}, {1, 0}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Expected invalid limit to panic", tt.rate, tt.burst)
+				}
+			}()
+
+			RateLimit(tt.rate, tt.burst)
+		}()
+	}
+}
+
+func ExampleObserveSend() {
+	counts := make(map[StateCode]int)
+	mb := NewWithOptions(1, Options{
+		SendInterceptors: []SendInterceptor{
+			ObserveSend(func(_ generic.T, state StateCode, _ time.Duration) {
+				counts[state]++
+			}),
+		},
+	})
+
+	mb.Send(1, false)
+	mb.Send(2, false)
+	fmt.Println("ok:", counts[StateOK], "full:", counts[StateFull])
+	// Output: ok: 1 full: 1
+}
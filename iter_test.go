@@ -0,0 +1,103 @@
+package mailbox
+
+import (
+	"iter"
+	"sync"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	var (
+		wg  sync.WaitGroup
+		cnt int
+	)
+
+	mb := New(testBufSize)
+	wg.Add(1)
+	go func() {
+		for _, si := range testSet {
+			mb.Send(si, true)
+		}
+
+		mb.Close()
+		wg.Done()
+	}()
+
+	for range mb.All() {
+		cnt++
+	}
+
+	wg.Wait()
+	if cnt != len(testSet) {
+		t.Fatal("Errr cnt", cnt)
+	}
+}
+
+func TestAllBreak(t *testing.T) {
+	mb := New(4)
+	for i := 0; i < 4; i++ {
+		mb.Send(i, false)
+	}
+
+	for msg := range mb.All() {
+		// The lock is not held while the loop body runs, calling into the mailbox is safe
+		mb.Send(msg, false)
+		if msg == 1 {
+			break
+		}
+	}
+
+	if mb.Len() != 4 {
+		t.Fatal("Invalid length", mb.Len())
+	}
+}
+
+func TestAllPull(t *testing.T) {
+	mb := New(4)
+	mb.Send(1, false)
+	mb.Send(2, false)
+	mb.Close()
+
+	next, stop := iter.Pull(mb.All())
+	defer stop()
+	for _, expected := range []int{1, 2} {
+		if msg, ok := next(); !ok || msg != expected {
+			t.Fatal("Invalid message", msg, ok)
+		}
+	}
+
+	if _, ok := next(); ok {
+		t.Fatal("Expected iteration to end once the mailbox is closed")
+	}
+}
+
+func TestBatches(t *testing.T) {
+	var (
+		wg  sync.WaitGroup
+		cnt int
+	)
+
+	mb := New(testBufSize)
+	wg.Add(1)
+	go func() {
+		for _, si := range testSet {
+			mb.Send(si, true)
+		}
+
+		mb.Close()
+		wg.Done()
+	}()
+
+	for msgs := range mb.Batches(32) {
+		if len(msgs) == 0 || len(msgs) > 32 {
+			t.Fatal("Invalid batch size", len(msgs))
+		}
+
+		cnt += len(msgs)
+	}
+
+	wg.Wait()
+	if cnt != len(testSet) {
+		t.Fatal("Errr cnt", cnt)
+	}
+}
@@ -1,8 +1,10 @@
 package mailbox
 
 import (
+	"runtime"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/joeshaw/gengen/generic"
 )
@@ -88,6 +90,182 @@ func TestMailboxNoWait(t *testing.T) {
 	}
 }
 
+func TestMailboxPopOverwrite(t *testing.T) {
+	mb := New(2)
+	mb.Send(1, false)
+	mb.Send(2, false)
+
+	// Our mailbox is full, the oldest message is overwritten and the length is kept at capacity
+	mb.mux.Lock()
+	mb.pop(3)
+	mb.mux.Unlock()
+	if n := mb.Len(); n != 2 {
+		t.Fatal("Invalid length", n)
+	}
+
+	for _, expected := range []int{2, 3} {
+		if msg, state := mb.Receive(false); state != StateOK || msg != expected {
+			t.Fatal("Invalid message", expected, msg, state)
+		}
+	}
+
+	if _, state := mb.Receive(false); state != StateEmpty {
+		t.Fatal("Invalid state code returned", state)
+	}
+}
+
+func TestMailboxClosed(t *testing.T) {
+	mb := New(1)
+	if mb.Send(1, false) != StateOK {
+		t.Fatal("Invalid state code returned")
+		return
+	}
+
+	done := make(chan StateCode)
+	go func() {
+		// Mailbox is full, this send will wait until the mailbox is closed
+		done <- mb.Send(1, true)
+	}()
+
+	mb.Close()
+	if state := <-done; state != StateClosed {
+		t.Fatal("Invalid state code returned", state)
+		return
+	}
+
+	if mb.Send(1, false) != StateClosed {
+		t.Fatal("Invalid state code returned")
+		return
+	}
+
+	if _, state := mb.Receive(false); state != StateOK {
+		t.Fatal("Invalid state code returned")
+		return
+	}
+
+	if _, state := mb.Receive(false); state != StateClosed {
+		t.Fatal("Invalid state code returned")
+		return
+	}
+}
+
+func TestMailboxClosedWhileWaiting(t *testing.T) {
+	mb := New(1)
+	mb.Send(1, false)
+	done := make(chan StateCode)
+	go func() {
+		// Mailbox is full, this send will wait
+		done <- mb.Send(2, true)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	// Make room once the mailbox is closed, but before the waiting send is notified
+	mb.mux.Lock()
+	go mb.Close()
+	for !mb.isClosed() {
+		runtime.Gosched()
+	}
+
+	mb.remove()
+	mb.mux.Unlock()
+	if state := <-done; state != StateClosed {
+		t.Fatal("Invalid state code returned", state)
+	}
+
+	if _, state := mb.Receive(false); state != StateClosed {
+		t.Fatal("Invalid state code returned", state)
+	}
+}
+
+func TestBatchAtomicClosedWhileWaiting(t *testing.T) {
+	mb := New(2)
+	mb.Send(1, false)
+	done := make(chan StateCode)
+	go func() {
+		// Batch doesn't fit, it will wait
+		_, state := mb.BatchN([]generic.T{2, 3}, BatchAtomic)
+		done <- state
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	// Make room once the mailbox is closed, but before the waiting batch is notified
+	mb.mux.Lock()
+	go mb.Close()
+	for !mb.isClosed() {
+		runtime.Gosched()
+	}
+
+	mb.remove()
+	mb.mux.Unlock()
+	if state := <-done; state != StateClosed {
+		t.Fatal("Invalid state code returned", state)
+	}
+
+	if _, state := mb.Receive(false); state != StateClosed {
+		t.Fatal("Invalid state code returned", state)
+	}
+}
+
+func TestBatchN(t *testing.T) {
+	mb := New(3)
+	if sent, state := mb.BatchN([]generic.T{1, 2}, BatchNoWait); sent != 2 || state != StateOK {
+		t.Fatal("Invalid batch result", sent, state)
+	}
+
+	if sent, state := mb.BatchN([]generic.T{3, 4}, BatchNoWait); sent != 1 || state != StateFull {
+		t.Fatal("Invalid batch result", sent, state)
+	}
+
+	if sent, state := mb.BatchN([]generic.T{1, 2, 3, 4}, BatchAtomic); sent != 0 || state != StateFull {
+		t.Fatal("Invalid batch result", sent, state)
+	}
+
+	done := make(chan int)
+	go func() {
+		// Batch requires two vacant entries, it should wait for both receives
+		sent, _ := mb.BatchN([]generic.T{5, 6}, BatchAtomic)
+		done <- sent
+	}()
+
+	for _, expected := range []generic.T{1, 2, 3, 5, 6} {
+		msg, state := mb.Receive(true)
+		if state != StateOK || msg != expected {
+			t.Fatal("Invalid message", msg, expected, state)
+		}
+	}
+
+	if sent := <-done; sent != 2 {
+		t.Fatal("Invalid sent count", sent)
+	}
+}
+
+func TestBatchNClosed(t *testing.T) {
+	mb := New(2)
+	done := make(chan int)
+	go func() {
+		sent, state := mb.BatchN([]generic.T{1, 2, 3, 4}, BatchWait)
+		if state != StateClosed {
+			t.Error("Invalid state code returned", state)
+		}
+
+		done <- sent
+	}()
+
+	// Wait for the batch to fill the mailbox, then close it mid-batch
+	for mb.Len() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	mb.Close()
+	if sent := <-done; sent != 2 {
+		t.Fatal("Invalid sent count", sent)
+	}
+
+	if sent, state := mb.BatchN([]generic.T{1}, BatchAtomic); sent != 0 || state != StateClosed {
+		t.Fatal("Invalid batch result", sent, state)
+	}
+}
+
 func BenchmarkMailbox(b *testing.B) {
 	var rwg sync.WaitGroup
 	mb := New(testBufSize)
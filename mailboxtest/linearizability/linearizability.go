@@ -0,0 +1,331 @@
+// Package linearizability checks concurrent histories of mailbox operations
+// against a sequential FIFO queue, following Wing & Gong with the memoization
+// of Lowe (as popularized by Porcupine).
+//
+// Operations are recorded from many goroutines, each stamped with a logical time
+// when it is invoked and when it returns:
+//
+//	var h linearizability.History
+//	call := h.Call()
+//	state := mb.Send(msg, false)
+//	h.Return(linearizability.Op{Kind: linearizability.Send, Value: 1, Result: result(state), Call: call})
+//
+// Check then searches for a total order of the operations which respects their
+// real-time order and which the sequential queue accepts.
+package linearizability
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Kind is the kind of an operation
+type Kind uint8
+
+const (
+	// Send is a call to Send, Value is the message sent
+	Send Kind = iota
+	// Receive is a call to Receive, Value is the message received
+	Receive
+	// Close is a call to Close
+	Close
+)
+
+// Result is the outcome of an operation, it maps to the mailbox state codes
+type Result uint8
+
+const (
+	// OK is a successful send or receive
+	OK Result = iota
+	// Empty is a receive which found the mailbox empty without waiting
+	Empty
+	// Full is a send which found the mailbox full without waiting
+	Full
+	// Closed is a send or receive which found the mailbox closed
+	Closed
+)
+
+// Op is a completed operation of a history
+type Op struct {
+	Kind Kind
+	// Wait is whether or not the operation was allowed to wait
+	Wait bool
+	// Value is the message sent or received, only used by OK sends and receives
+	Value  int
+	Result Result
+	// Call and Return are the logical times the operation was invoked and returned at
+	Call   int64
+	Return int64
+}
+
+// String will return a readable form of the operation
+func (o Op) String() string {
+	var name string
+	switch o.Kind {
+	case Send:
+		name = "Send(" + strconv.Itoa(o.Value) + ", " + strconv.FormatBool(o.Wait) + ")"
+	case Receive:
+		name = "Receive(" + strconv.FormatBool(o.Wait) + ")"
+	case Close:
+		return fmt.Sprintf("[%d, %d] Close()", o.Call, o.Return)
+	}
+
+	res := [...]string{OK: "OK", Empty: "Empty", Full: "Full", Closed: "Closed"}[o.Result]
+	if o.Kind == Receive && o.Result == OK {
+		res += " " + strconv.Itoa(o.Value)
+	}
+
+	return fmt.Sprintf("[%d, %d] %s = %s", o.Call, o.Return, name, res)
+}
+
+// History records completed operations from many goroutines
+type History struct {
+	// clock is the logical clock, atomic so that its order matches real time
+	clock atomic.Int64
+
+	mux sync.Mutex
+	ops []Op
+}
+
+// Call will return the logical time of an invocation, it must be called immediately
+// before the operation is invoked
+func (h *History) Call() int64 {
+	return h.clock.Add(1)
+}
+
+// Return will stamp the provided operation with the logical time of its return and
+// record it, it must be called immediately after the operation returns
+func (h *History) Return(op Op) {
+	op.Return = h.clock.Add(1)
+	h.mux.Lock()
+	h.ops = append(h.ops, op)
+	h.mux.Unlock()
+}
+
+// Ops will return the operations recorded, in order of invocation
+func (h *History) Ops() (ops []Op) {
+	h.mux.Lock()
+	ops = append(ops, h.ops...)
+	h.mux.Unlock()
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Call < ops[j].Call })
+	return
+}
+
+// String will return the recorded operations, one per line
+func (h *History) String() string {
+	var sb strings.Builder
+	for _, op := range h.Ops() {
+		sb.WriteString(op.String())
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// Check will return whether or not the provided operations are linearizable against
+// a FIFO queue holding up to sz messages
+func Check(sz int, ops []Op) bool {
+	var (
+		stack []frame
+		// linearized is the set of operations in our current order, by index
+		linearized = make(bitset, (len(ops)+63)/64)
+		// seen are the (linearized, state) pairs already explored, Lowe's memoization
+		seen = make(map[string]struct{})
+	)
+
+	s := model{sz: sz}
+	head := events(ops)
+	e := head.next
+	for head.next != nil {
+		if e.ret {
+			// Our first pending operation returned before we could linearize it, backtrack
+			if len(stack) == 0 {
+				return false
+			}
+
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			s = f.s
+			linearized.clear(f.e.id)
+			f.e.unlift()
+			e = f.e.next
+			continue
+		}
+
+		if next, ok := s.step(ops[e.id]); ok {
+			linearized.set(e.id)
+			key := linearized.key() + next.key()
+			if _, ok = seen[key]; !ok {
+				seen[key] = struct{}{}
+				stack = append(stack, frame{e: e, s: s})
+				s = next
+				e.lift()
+				e = head.next
+				continue
+			}
+
+			linearized.clear(e.id)
+		}
+
+		e = e.next
+	}
+
+	return true
+}
+
+// frame is a linearized operation along with the state before it
+type frame struct {
+	e *event
+	s model
+}
+
+// event is the call or return of an operation, in a doubly linked list ordered by time
+type event struct {
+	id   int
+	ret  bool
+	prev *event
+	next *event
+	// match is the return of a call
+	match *event
+}
+
+// events will return the head of the list of events of the provided operations
+func events(ops []Op) (head *event) {
+	type stamped struct {
+		t int64
+		e *event
+	}
+
+	all := make([]stamped, 0, len(ops)*2)
+	for i, op := range ops {
+		call := &event{id: i}
+		call.match = &event{id: i, ret: true}
+		all = append(all, stamped{op.Call, call}, stamped{op.Return, call.match})
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i].t < all[j].t })
+	head = &event{id: -1}
+	prev := head
+	for _, s := range all {
+		s.e.prev = prev
+		prev.next = s.e
+		prev = s.e
+	}
+
+	return
+}
+
+// lift will remove a call and its return from the list
+func (e *event) lift() {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	m := e.match
+	m.prev.next = m.next
+	if m.next != nil {
+		m.next.prev = m.prev
+	}
+}
+
+// unlift will restore a call and its return removed by lift
+func (e *event) unlift() {
+	m := e.match
+	m.prev.next = m
+	if m.next != nil {
+		m.next.prev = m
+	}
+
+	e.prev.next = e
+	e.next.prev = e
+}
+
+// model is the sequential specification of a mailbox, a FIFO queue which can be closed
+type model struct {
+	sz     int
+	q      []int
+	closed bool
+}
+
+// step will return the state after the provided operation, ok is false when the
+// operation (and its result) is not possible in the current state
+func (m model) step(op Op) (next model, ok bool) {
+	next = m
+	switch op.Kind {
+	case Close:
+		next.closed = true
+		return next, true
+
+	case Send:
+		switch {
+		case m.closed:
+			return next, op.Result == Closed
+		case len(m.q) == m.sz:
+			// A waiting send cannot take effect until there is room
+			return next, !op.Wait && op.Result == Full
+		case op.Result != OK:
+			return next, false
+		}
+
+		// Copy our queue, previous states are kept for backtracking
+		next.q = append(append(make([]int, 0, len(m.q)+1), m.q...), op.Value)
+		return next, true
+
+	case Receive:
+		switch {
+		case len(m.q) > 0:
+			if op.Result != OK || op.Value != m.q[0] {
+				return next, false
+			}
+
+			next.q = m.q[1:]
+			return next, true
+		case m.closed:
+			return next, op.Result == Closed
+		default:
+			// A waiting receive cannot take effect until there is a message
+			return next, !op.Wait && op.Result == Empty
+		}
+	}
+
+	return next, false
+}
+
+// key will return a unique encoding of the state
+func (m model) key() string {
+	var sb strings.Builder
+	if m.closed {
+		sb.WriteByte('c')
+	}
+
+	for _, v := range m.q {
+		sb.WriteByte(',')
+		sb.WriteString(strconv.Itoa(v))
+	}
+
+	return sb.String()
+}
+
+// bitset is a set of operation indexes
+type bitset []uint64
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) clear(i int) {
+	b[i/64] &^= 1 << (i % 64)
+}
+
+// key will return a unique encoding of the set
+func (b bitset) key() string {
+	var sb strings.Builder
+	for _, w := range b {
+		sb.WriteString(strconv.FormatUint(w, 36))
+		sb.WriteByte('/')
+	}
+
+	return sb.String()
+}
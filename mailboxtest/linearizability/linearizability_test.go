@@ -0,0 +1,160 @@
+package linearizability
+
+import (
+	"sync"
+	"testing"
+)
+
+// op will return an operation invoked at call which returned at ret
+func op(kind Kind, wait bool, value int, res Result, call, ret int64) Op {
+	return Op{Kind: kind, Wait: wait, Value: value, Result: res, Call: call, Return: ret}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		sz   int
+		ops  []Op
+		ok   bool
+	}{
+		{
+			name: "sequential",
+			sz:   2,
+			ops: []Op{
+				op(Send, false, 1, OK, 1, 2),
+				op(Send, false, 2, OK, 3, 4),
+				op(Send, false, 3, Full, 5, 6),
+				op(Receive, false, 1, OK, 7, 8),
+				op(Receive, false, 2, OK, 9, 10),
+				op(Receive, false, 0, Empty, 11, 12),
+			},
+			ok: true,
+		},
+		{
+			name: "reordered",
+			sz:   2,
+			ops: []Op{
+				op(Send, false, 1, OK, 1, 2),
+				op(Send, false, 2, OK, 3, 4),
+				op(Receive, false, 2, OK, 5, 6),
+			},
+		},
+		{
+			name: "concurrent sends in either order",
+			sz:   2,
+			ops: []Op{
+				op(Send, false, 1, OK, 1, 4),
+				op(Send, false, 2, OK, 2, 3),
+				op(Receive, false, 2, OK, 5, 6),
+				op(Receive, false, 1, OK, 7, 8),
+			},
+			ok: true,
+		},
+		{
+			name: "duplicated",
+			sz:   2,
+			ops: []Op{
+				op(Send, false, 1, OK, 1, 2),
+				op(Receive, false, 1, OK, 3, 4),
+				op(Receive, false, 1, OK, 5, 6),
+			},
+		},
+		{
+			name: "lost",
+			sz:   2,
+			ops: []Op{
+				op(Send, false, 1, OK, 1, 2),
+				op(Receive, false, 0, Empty, 3, 4),
+			},
+		},
+		{
+			name: "waiting receive",
+			sz:   1,
+			ops: []Op{
+				op(Receive, true, 1, OK, 1, 6),
+				op(Receive, false, 0, Empty, 2, 3),
+				op(Send, false, 1, OK, 4, 5),
+			},
+			ok: true,
+		},
+		{
+			name: "waiting send on a full mailbox",
+			sz:   1,
+			ops: []Op{
+				op(Send, false, 1, OK, 1, 2),
+				op(Send, true, 2, OK, 3, 4),
+			},
+		},
+		{
+			name: "close",
+			sz:   2,
+			ops: []Op{
+				op(Send, false, 1, OK, 1, 2),
+				op(Close, false, 0, OK, 3, 4),
+				op(Send, true, 2, Closed, 5, 6),
+				op(Receive, true, 1, OK, 7, 8),
+				op(Receive, true, 0, Closed, 9, 10),
+			},
+			ok: true,
+		},
+		{
+			name: "closed before drained",
+			sz:   2,
+			ops: []Op{
+				op(Send, false, 1, OK, 1, 2),
+				op(Close, false, 0, OK, 3, 4),
+				op(Receive, false, 0, Closed, 5, 6),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if ok := Check(tt.sz, tt.ops); ok != tt.ok {
+			t.Errorf("%s: expected %v and received %v", tt.name, tt.ok, ok)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var (
+		h  History
+		wg sync.WaitGroup
+	)
+
+	// A mutex guarded slice is a linearizable queue
+	var (
+		mux sync.Mutex
+		q   []int
+	)
+
+	for c := 0; c < 4; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < 8; i++ {
+				call := h.Call()
+				mux.Lock()
+				q = append(q, c*8+i)
+				mux.Unlock()
+				h.Return(Op{Kind: Send, Value: c*8 + i, Call: call})
+
+				call = h.Call()
+				mux.Lock()
+				v := q[0]
+				q = q[1:]
+				mux.Unlock()
+				h.Return(Op{Kind: Receive, Value: v, Call: call})
+			}
+		}(c)
+	}
+
+	wg.Wait()
+	ops := h.Ops()
+	if len(ops) != 64 {
+		t.Fatal("Invalid number of operations", len(ops))
+	}
+
+	if !Check(64, ops) {
+		t.Fatal("History is not linearizable\n" + h.String())
+	}
+}
@@ -0,0 +1,620 @@
+// Package mailboxtest is a conformance suite for mailbox implementations. It checks
+// FIFO ordering, the Empty, Full, Ended and Closed states, closing while callers
+// are blocked, batch semantics, that no message is lost or duplicated under
+// concurrency and that concurrent histories of Send, Receive and Close are
+// linearizable (See the linearizability package, a failing history is replayed with
+// the -mailboxtest.seed flag). It runs against the root package, every typed package
+// and any other implementation of the mailbox interface:
+//
+//	func TestConformance(t *testing.T) {
+//		mailboxtest.Run(t, mailboxtest.Factory[int, mailbox.StateCode]{
+//			New:     func(sz int) mailboxtest.Mailbox[int, mailbox.StateCode] { return mailbox.New(sz) },
+//			States:  mailboxtest.States[mailbox.StateCode]{...},
+//			Message: func(i int) int { return i },
+//			Index:   func(msg int) int { return msg },
+//		})
+//	}
+package mailboxtest
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsmontoya/mailbox/mailboxtest/linearizability"
+)
+
+// seedFlag replays the operations of a single linearizability history, their
+// interleaving is still up to the scheduler
+var seedFlag = flag.Int64("mailboxtest.seed", 0, "run a single linearizability history seed, e.g. to replay a failure")
+
+const (
+	// MaxMessages is the upper bound (exclusive) of the indexes Message is called with
+	MaxMessages = senders * perSender
+	// Timeout is how long the suite waits for a call which is expected to return
+	Timeout = 5 * time.Second
+
+	// senders and perSender are the shape of the concurrent checks
+	senders   = 4
+	perSender = 1024
+	// blocked is how long the suite waits for a call to block before unblocking it
+	blocked = 10 * time.Millisecond
+
+	// histories is the number of histories checked for linearizability, each made up
+	// of opsPerClient operations from each of clients goroutines
+	histories    = 16
+	clients      = 4
+	opsPerClient = 24
+)
+
+// Sizes are the mailbox sizes every check runs with
+var Sizes = []int{1, 2, 16}
+
+// Mailbox is the behaviour under test, it matches mailbox.Interface for messages
+// of T and state codes of S
+type Mailbox[T any, S comparable] interface {
+	Send(msg T, wait bool) (state S)
+	Batch(msgs ...T)
+	Receive(wait bool) (msg T, state S)
+	Listen(fn func(msg T) (end bool)) (state S)
+	Close()
+}
+
+// States are the state codes of the implementation under test
+type States[S comparable] struct {
+	OK     S
+	Empty  S
+	Full   S
+	Ended  S
+	Closed S
+}
+
+// Factory describes an implementation under test
+type Factory[T any, S comparable] struct {
+	// New returns a new, empty mailbox holding up to sz messages
+	New func(sz int) Mailbox[T, S]
+	// States are the state codes returned by the mailbox
+	States States[S]
+	// Message returns the message for an index, 0 <= i < MaxMessages. It may be
+	// called from several goroutines at once
+	Message func(i int) T
+	// Index returns the index of a message returned by Message
+	Index func(msg T) int
+	// Distinct is the number of distinct messages the type can represent, zero when
+	// it is at least MaxMessages. Index must return i % Distinct when it is set, so
+	// that types such as int8 only have their counts checked under concurrency. When
+	// it is 1 (e.g. struct{}) ordering cannot be observed at all: FIFO is skipped and
+	// the remaining checks only cover states and counts
+	Distinct int
+}
+
+// Run will run the conformance suite against the provided factory
+func Run[T any, S comparable](t *testing.T, f Factory[T, S]) {
+	s := suite[T, S]{f: f}
+	for _, sz := range Sizes {
+		t.Run(fmt.Sprintf("size=%d", sz), func(t *testing.T) {
+			t.Run("FIFO", func(t *testing.T) { s.fifo(t, sz) })
+			t.Run("EmptyFull", func(t *testing.T) { s.emptyFull(t, sz) })
+			t.Run("Ended", func(t *testing.T) { s.ended(t, sz) })
+			t.Run("Closed", func(t *testing.T) { s.closed(t, sz) })
+			t.Run("CloseBlockedReceive", func(t *testing.T) { s.closeBlockedReceive(t, sz) })
+			t.Run("CloseBlockedSend", func(t *testing.T) { s.closeBlockedSend(t, sz) })
+			t.Run("CloseBlockedListen", func(t *testing.T) { s.closeBlockedListen(t, sz) })
+			t.Run("Batch", func(t *testing.T) { s.batch(t, sz) })
+			t.Run("CloseBlockedBatch", func(t *testing.T) { s.closeBlockedBatch(t, sz) })
+			t.Run("Concurrent", func(t *testing.T) { s.concurrent(t, sz, 1) })
+			t.Run("ConcurrentReceivers", func(t *testing.T) { s.concurrent(t, sz, senders) })
+			t.Run("Linearizable", func(t *testing.T) { s.linearizable(t, sz) })
+		})
+	}
+}
+
+type suite[T any, S comparable] struct {
+	f Factory[T, S]
+}
+
+// key will return the expected index of the message for i
+func (s *suite[T, S]) key(i int) int {
+	if s.f.Distinct > 0 {
+		return i % s.f.Distinct
+	}
+
+	return i
+}
+
+// expect will receive a message without waiting, failing unless it is the message for i
+func (s *suite[T, S]) expect(t *testing.T, mb Mailbox[T, S], i int) {
+	t.Helper()
+	msg, state := mb.Receive(false)
+	if state != s.f.States.OK {
+		t.Fatalf("Invalid state code returned for message %d: %v", i, state)
+	}
+
+	if idx := s.f.Index(msg); idx != s.key(i) {
+		t.Fatalf("Invalid message, expected %d and received %d", s.key(i), idx)
+	}
+}
+
+// expectState will receive without waiting, failing unless the provided state is returned
+func (s *suite[T, S]) expectState(t *testing.T, mb Mailbox[T, S], state S) {
+	t.Helper()
+	if _, rs := mb.Receive(false); rs != state {
+		t.Fatalf("Invalid state code returned, expected %v and received %v", state, rs)
+	}
+}
+
+// fill will send the messages for 0 through n-1 without waiting
+func (s *suite[T, S]) fill(t *testing.T, mb Mailbox[T, S], n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if state := mb.Send(s.f.Message(i), false); state != s.f.States.OK {
+			t.Fatalf("Invalid state code returned for message %d: %v", i, state)
+		}
+	}
+}
+
+func (s *suite[T, S]) fifo(t *testing.T, sz int) {
+	if s.f.Distinct == 1 {
+		t.Skip("Ordering cannot be observed with a single distinct message")
+	}
+
+	mb := s.f.New(sz)
+	n := sz*3 + 1
+	go func() {
+		for i := 0; i < n; i++ {
+			mb.Send(s.f.Message(i), true)
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		msg, state := receive(t, mb, true)
+		if state != s.f.States.OK {
+			t.Fatalf("Invalid state code returned for message %d: %v", i, state)
+		}
+
+		if idx := s.f.Index(msg); idx != s.key(i) {
+			t.Fatalf("Invalid message, expected %d and received %d", s.key(i), idx)
+		}
+	}
+
+	s.expectState(t, mb, s.f.States.Empty)
+}
+
+func (s *suite[T, S]) emptyFull(t *testing.T, sz int) {
+	mb := s.f.New(sz)
+	s.expectState(t, mb, s.f.States.Empty)
+	s.fill(t, mb, sz)
+	if state := mb.Send(s.f.Message(sz), false); state != s.f.States.Full {
+		t.Fatalf("Invalid state code returned for a full mailbox: %v", state)
+	}
+
+	// Receiving a single message makes room for a single message
+	s.expect(t, mb, 0)
+	if state := mb.Send(s.f.Message(sz), false); state != s.f.States.OK {
+		t.Fatalf("Invalid state code returned: %v", state)
+	}
+
+	if state := mb.Send(s.f.Message(sz+1), false); state != s.f.States.Full {
+		t.Fatalf("Invalid state code returned for a full mailbox: %v", state)
+	}
+
+	// The rejected sends must not have been added
+	for i := 1; i <= sz; i++ {
+		s.expect(t, mb, i)
+	}
+
+	s.expectState(t, mb, s.f.States.Empty)
+}
+
+func (s *suite[T, S]) ended(t *testing.T, sz int) {
+	var cnt int
+	mb := s.f.New(sz)
+	s.fill(t, mb, sz)
+	state := listen(t, mb, func(msg T) (end bool) {
+		if idx := s.f.Index(msg); idx != s.key(cnt) {
+			t.Errorf("Invalid message, expected %d and received %d", s.key(cnt), idx)
+		}
+
+		cnt++
+		return true
+	})
+
+	if state != s.f.States.Ended || cnt != 1 {
+		t.Fatalf("Invalid listen result, state %v after %d messages", state, cnt)
+	}
+
+	// Ending a listen leaves the remaining messages in the mailbox
+	for i := 1; i < sz; i++ {
+		s.expect(t, mb, i)
+	}
+
+	s.expectState(t, mb, s.f.States.Empty)
+}
+
+func (s *suite[T, S]) closed(t *testing.T, sz int) {
+	mb := s.f.New(sz)
+	s.fill(t, mb, sz)
+	mb.Close()
+	if state := mb.Send(s.f.Message(sz), false); state != s.f.States.Closed {
+		t.Fatalf("Invalid state code returned for a closed mailbox: %v", state)
+	}
+
+	if state := mb.Send(s.f.Message(sz), true); state != s.f.States.Closed {
+		t.Fatalf("Invalid state code returned for a closed mailbox: %v", state)
+	}
+
+	// Messages sent before the close are still received, in order
+	for i := 0; i < sz; i++ {
+		s.expect(t, mb, i)
+	}
+
+	s.expectState(t, mb, s.f.States.Closed)
+	if _, state := receive(t, mb, true); state != s.f.States.Closed {
+		t.Fatalf("Invalid state code returned for a closed mailbox: %v", state)
+	}
+
+	if state := listen(t, mb, func(T) bool { return false }); state != s.f.States.Closed {
+		t.Fatalf("Invalid state code returned for a closed mailbox: %v", state)
+	}
+
+	// Closing twice is safe
+	mb.Close()
+}
+
+func (s *suite[T, S]) closeBlockedReceive(t *testing.T, sz int) {
+	mb := s.f.New(sz)
+	done := make(chan S, 1)
+	go func() {
+		_, state := mb.Receive(true)
+		done <- state
+	}()
+
+	time.Sleep(blocked)
+	mb.Close()
+	if state := wait(t, done); state != s.f.States.Closed {
+		t.Fatalf("Invalid state code returned for a blocked receive: %v", state)
+	}
+}
+
+func (s *suite[T, S]) closeBlockedSend(t *testing.T, sz int) {
+	mb := s.f.New(sz)
+	s.fill(t, mb, sz)
+	done := make(chan S, 1)
+	go func() {
+		done <- mb.Send(s.f.Message(sz), true)
+	}()
+
+	time.Sleep(blocked)
+	mb.Close()
+	if state := wait(t, done); state != s.f.States.Closed {
+		t.Fatalf("Invalid state code returned for a blocked send: %v", state)
+	}
+
+	// The blocked send must not have been added
+	for i := 0; i < sz; i++ {
+		s.expect(t, mb, i)
+	}
+
+	s.expectState(t, mb, s.f.States.Closed)
+}
+
+func (s *suite[T, S]) closeBlockedListen(t *testing.T, sz int) {
+	var cnt int
+	mb := s.f.New(sz)
+	s.fill(t, mb, sz)
+	done := make(chan S, 1)
+	go func() {
+		done <- mb.Listen(func(msg T) (end bool) {
+			if idx := s.f.Index(msg); idx != s.key(cnt) {
+				t.Errorf("Invalid message, expected %d and received %d", s.key(cnt), idx)
+			}
+
+			cnt++
+			return
+		})
+	}()
+
+	time.Sleep(blocked)
+	mb.Close()
+	if state := wait(t, done); state != s.f.States.Closed || cnt != sz {
+		t.Fatalf("Invalid listen result, state %v after %d messages", state, cnt)
+	}
+}
+
+func (s *suite[T, S]) batch(t *testing.T, sz int) {
+	mb := s.f.New(sz)
+	// A batch larger than the mailbox is delivered in order as room is made
+	n := sz*2 + 1
+	msgs := make([]T, n)
+	for i := range msgs {
+		msgs[i] = s.f.Message(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		mb.Batch(msgs...)
+		close(done)
+	}()
+
+	for i := 0; i < n; i++ {
+		msg, state := receive(t, mb, true)
+		if state != s.f.States.OK {
+			t.Fatalf("Invalid state code returned for message %d: %v", i, state)
+		}
+
+		if idx := s.f.Index(msg); idx != s.key(i) {
+			t.Fatalf("Invalid message, expected %d and received %d", s.key(i), idx)
+		}
+	}
+
+	wait(t, done)
+	s.expectState(t, mb, s.f.States.Empty)
+
+	// An empty batch is a no-op
+	mb.Batch()
+	s.expectState(t, mb, s.f.States.Empty)
+
+	// A batch sent after close is discarded
+	mb.Close()
+	mb.Batch(msgs[:1]...)
+	s.expectState(t, mb, s.f.States.Closed)
+}
+
+func (s *suite[T, S]) closeBlockedBatch(t *testing.T, sz int) {
+	mb := s.f.New(sz)
+	s.fill(t, mb, sz)
+	done := make(chan struct{})
+	go func() {
+		mb.Batch(s.f.Message(sz), s.f.Message(sz+1))
+		close(done)
+	}()
+
+	time.Sleep(blocked)
+	mb.Close()
+	wait(t, done)
+	// The messages sent before the close are still received, the batch is not
+	for i := 0; i < sz; i++ {
+		s.expect(t, mb, i)
+	}
+
+	s.expectState(t, mb, s.f.States.Closed)
+}
+
+// concurrent will send perSender messages from each of several senders, half of them
+// through batches, to the provided number of receivers. Every message must be received
+// exactly once and each receiver must observe the messages of a sender in order
+func (s *suite[T, S]) concurrent(t *testing.T, sz, receivers int) {
+	var (
+		swg sync.WaitGroup
+		rwg sync.WaitGroup
+	)
+
+	mb := s.f.New(sz)
+	received := make([][]int, receivers)
+	for r := 0; r < receivers; r++ {
+		rwg.Add(1)
+		go func(r int) {
+			defer rwg.Done()
+			// Alternate between receiving and listening
+			if r%2 == 1 {
+				mb.Listen(func(msg T) (end bool) {
+					received[r] = append(received[r], s.f.Index(msg))
+					return
+				})
+
+				return
+			}
+
+			for {
+				msg, state := mb.Receive(true)
+				if state != s.f.States.OK {
+					return
+				}
+
+				received[r] = append(received[r], s.f.Index(msg))
+			}
+		}(r)
+	}
+
+	for snd := 0; snd < senders; snd++ {
+		swg.Add(1)
+		go func(snd int) {
+			defer swg.Done()
+			base := snd * perSender
+			for i := 0; i < perSender/2; i++ {
+				if state := mb.Send(s.f.Message(base+i), true); state != s.f.States.OK {
+					t.Errorf("Invalid state code returned for message %d: %v", base+i, state)
+				}
+			}
+
+			for i := perSender / 2; i < perSender; i += 4 {
+				mb.Batch(s.f.Message(base+i), s.f.Message(base+i+1), s.f.Message(base+i+2), s.f.Message(base+i+3))
+			}
+		}(snd)
+	}
+
+	wait(t, waitGroup(&swg))
+	mb.Close()
+	wait(t, waitGroup(&rwg))
+
+	counts := make(map[int]int, MaxMessages)
+	for i := 0; i < MaxMessages; i++ {
+		counts[s.key(i)]++
+	}
+
+	for _, idxs := range received {
+		for _, idx := range idxs {
+			counts[idx]--
+		}
+	}
+
+	for idx, cnt := range counts {
+		switch {
+		case cnt > 0:
+			t.Fatalf("Message %d was lost %d time(s)", idx, cnt)
+		case cnt < 0:
+			t.Fatalf("Message %d was duplicated %d time(s)", idx, -cnt)
+		}
+	}
+
+	if s.f.Distinct > 0 {
+		// Order cannot be checked for messages which are not distinct
+		return
+	}
+
+	for r, idxs := range received {
+		last := make([]int, senders)
+		for i := range last {
+			last[i] = -1
+		}
+
+		for _, idx := range idxs {
+			snd := idx / perSender
+			if idx <= last[snd] {
+				t.Fatalf("Receiver %d received message %d after message %d", r, idx, last[snd])
+			}
+
+			last[snd] = idx
+		}
+	}
+}
+
+// linearizable will record histories of random operations from several clients and
+// check each against a FIFO queue. The mailbox is closed once the clients are done, or
+// once they have had a chance to block, so that closing races with their operations
+func (s *suite[T, S]) linearizable(t *testing.T, sz int) {
+	n, seed := histories, time.Now().UnixNano()
+	if *seedFlag != 0 {
+		n, seed = 1, *seedFlag
+	}
+
+	t.Logf("Linearizability histories start at seed %d", seed)
+	for ; n > 0; n, seed = n-1, seed+clients {
+		var (
+			h  linearizability.History
+			wg sync.WaitGroup
+		)
+
+		mb := s.f.New(sz)
+		for c := 0; c < clients; c++ {
+			wg.Add(1)
+			go func(rng *rand.Rand, c int) {
+				defer wg.Done()
+				for i := 0; i < opsPerClient; i++ {
+					s.record(&h, mb, rng, c*opsPerClient+i)
+				}
+			}(rand.New(rand.NewSource(seed+int64(c))), c)
+		}
+
+		select {
+		case <-waitGroup(&wg):
+		case <-time.After(blocked):
+		}
+
+		call := h.Call()
+		mb.Close()
+		h.Return(linearizability.Op{Kind: linearizability.Close, Call: call})
+		wait(t, waitGroup(&wg))
+		if !linearizability.Check(sz, h.Ops()) {
+			t.Fatalf("History is not linearizable, replay with -mailboxtest.seed=%d:\n%s", seed, h.String())
+		}
+	}
+}
+
+// record will perform a random operation and record it, i is the index of the message sent
+func (s *suite[T, S]) record(h *linearizability.History, mb Mailbox[T, S], rng *rand.Rand, i int) {
+	var (
+		msg   T
+		state S
+	)
+
+	// Waiting operations are less likely, so that the clients rarely all block
+	op := linearizability.Op{Wait: rng.Intn(4) == 0}
+	if rng.Intn(2) == 0 {
+		op.Kind, op.Value = linearizability.Send, s.key(i)
+		msg = s.f.Message(i)
+		op.Call = h.Call()
+		state = mb.Send(msg, op.Wait)
+	} else {
+		op.Kind = linearizability.Receive
+		op.Call = h.Call()
+		msg, state = mb.Receive(op.Wait)
+	}
+
+	op.Result = s.result(state)
+	if op.Kind == linearizability.Receive && op.Result == linearizability.OK {
+		op.Value = s.f.Index(msg)
+	}
+
+	h.Return(op)
+}
+
+// result will return the linearizability result of a state code
+func (s *suite[T, S]) result(state S) linearizability.Result {
+	switch state {
+	case s.f.States.Empty:
+		return linearizability.Empty
+	case s.f.States.Full:
+		return linearizability.Full
+	case s.f.States.Closed:
+		return linearizability.Closed
+	}
+
+	return linearizability.OK
+}
+
+// receive will receive a message, failing if it does not return within Timeout
+func receive[T any, S comparable](t *testing.T, mb Mailbox[T, S], wait bool) (msg T, state S) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		msg, state = mb.Receive(wait)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(Timeout):
+		t.Fatal("Receive did not return")
+	}
+
+	return
+}
+
+// listen will listen to a mailbox, failing if it does not return within Timeout
+func listen[T any, S comparable](t *testing.T, mb Mailbox[T, S], fn func(msg T) (end bool)) (state S) {
+	t.Helper()
+	done := make(chan S, 1)
+	go func() {
+		done <- mb.Listen(fn)
+	}()
+
+	return wait(t, done)
+}
+
+// wait will return the value received from the provided channel, failing if none
+// is received within Timeout
+func wait[V any](t *testing.T, ch <-chan V) (v V) {
+	t.Helper()
+	select {
+	case v = <-ch:
+	case <-time.After(Timeout):
+		t.Fatal("Call did not return")
+	}
+
+	return
+}
+
+// waitGroup will return a channel which is closed once the provided wait group is done
+func waitGroup(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
@@ -0,0 +1,226 @@
+// Package sim is a deterministic simulation harness for mailboxes. Simulated
+// goroutines run one at a time, and whenever one yields or blocks in a mailbox the
+// next one to run is picked by a seeded random source. A seed therefore describes a
+// single interleaving, and a failing seed replays exactly:
+//
+//	sim.Explore(t, 1000, func(t *testing.T, s *sim.Sim) {
+//		mb := mailbox.NewWithOptions(1, mailbox.Options{Scheduler: s})
+//		s.Go(func() { mb.Batch(1, 2) })
+//		s.Go(func() { s.Yield(); mb.Close() })
+//		if err := s.Run(); err != nil {
+//			t.Fatal(err)
+//		}
+//	})
+//
+// Every call into a simulated mailbox must be made from a simulated goroutine, and
+// simulated goroutines must not block on anything other than a simulated mailbox.
+package sim
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+var (
+	seedFlag  = flag.Int64("sim.seed", 0, "run a single simulation seed, e.g. to replay a failure")
+	seedsFlag = flag.Int("sim.seeds", 0, "number of simulation seeds to explore, overrides the count of each test")
+)
+
+// ErrDeadlock is returned by Run when every remaining simulated goroutine is blocked
+var ErrDeadlock = errors.New("sim: all simulated goroutines are blocked")
+
+// Cond is the condition variable of a simulation, it matches mailbox.Cond
+type Cond = interface {
+	Wait()
+	Broadcast()
+}
+
+// New returns a new simulation for the provided seed
+func New(seed int64) *Sim {
+	return &Sim{
+		seed: seed,
+		rng:  rand.New(rand.NewSource(seed)),
+		done: make(chan error, 1),
+	}
+}
+
+// Sim is a deterministic scheduler of simulated goroutines, it is a mailbox.Scheduler
+type Sim struct {
+	seed int64
+	rng  *rand.Rand
+
+	// mux guards the fields below, it is only contended by the caller of Run
+	mux sync.Mutex
+	// current is the simulated goroutine which is running
+	current *thread
+	// runnable are the simulated goroutines which are ready to run, in a deterministic order
+	runnable []*thread
+	// live is the number of simulated goroutines which have not returned
+	live  int
+	ids   int
+	trace []int
+	// done receives the outcome of Run once nothing is runnable
+	done chan error
+}
+
+// thread is a simulated goroutine, it runs each time it receives from run
+type thread struct {
+	id  int
+	run chan struct{}
+}
+
+// Seed will return the seed of the simulation
+func (s *Sim) Seed() int64 {
+	return s.seed
+}
+
+// Go will start fn as a simulated goroutine, it first runs once it is scheduled
+func (s *Sim) Go(fn func()) {
+	s.mux.Lock()
+	t := &thread{id: s.ids, run: make(chan struct{}, 1)}
+	s.ids++
+	s.live++
+	s.runnable = append(s.runnable, t)
+	s.mux.Unlock()
+
+	go func() {
+		<-t.run
+		fn()
+
+		s.mux.Lock()
+		s.live--
+		s.schedule()
+		s.mux.Unlock()
+	}()
+}
+
+// Yield will let the scheduler pick the next simulated goroutine to run, which may
+// be the caller. It is how tests introduce interleavings between mailbox calls
+// Note: Must be called from a simulated goroutine
+func (s *Sim) Yield() {
+	s.mux.Lock()
+	t := s.self()
+	s.runnable = append(s.runnable, t)
+	s.schedule()
+	s.mux.Unlock()
+	<-t.run
+}
+
+// Run will run the simulated goroutines until they have all returned. ErrDeadlock is
+// returned when the remaining simulated goroutines are all blocked, they are then
+// abandoned. Run must be called once, from a goroutine which isn't simulated
+func (s *Sim) Run() error {
+	s.mux.Lock()
+	s.schedule()
+	s.mux.Unlock()
+	return <-s.done
+}
+
+// Trace will return the IDs of the simulated goroutines in the order they were
+// scheduled, IDs are assigned in the order of the calls to Go starting at zero
+func (s *Sim) Trace() (ids []int) {
+	s.mux.Lock()
+	ids = append(ids, s.trace...)
+	s.mux.Unlock()
+	return
+}
+
+// NewCond will return a cond whose waiters are scheduled by the simulation
+func (s *Sim) NewCond(l sync.Locker) Cond {
+	return &cond{s: s, l: l}
+}
+
+// self will return the running simulated goroutine
+// Note: Lock is expected to be held when calling
+func (s *Sim) self() *thread {
+	if s.current == nil {
+		panic("sim: called from a goroutine which isn't simulated")
+	}
+
+	return s.current
+}
+
+// schedule will pick the next simulated goroutine and let it run, Run is notified
+// once nothing is runnable
+// Note: Lock is expected to be held when calling
+func (s *Sim) schedule() {
+	if len(s.runnable) == 0 {
+		s.current = nil
+		if s.live == 0 {
+			s.done <- nil
+		} else {
+			s.done <- fmt.Errorf("%w (%d of them, seed %d)", ErrDeadlock, s.live, s.seed)
+		}
+
+		return
+	}
+
+	i := s.rng.Intn(len(s.runnable))
+	t := s.runnable[i]
+	// Retain the order of the remaining goroutines, so that picks depend only on the seed
+	s.runnable = append(s.runnable[:i], s.runnable[i+1:]...)
+	s.current = t
+	s.trace = append(s.trace, t.id)
+	t.run <- struct{}{}
+}
+
+// cond is a simulated condition variable
+type cond struct {
+	s *Sim
+	l sync.Locker
+	// waiters are guarded by the lock of the simulation
+	waiters []*thread
+}
+
+func (c *cond) Wait() {
+	s := c.s
+	s.mux.Lock()
+	t := s.self()
+	c.waiters = append(c.waiters, t)
+	s.mux.Unlock()
+
+	// Only the running goroutine touches l, it is released before the next one runs
+	c.l.Unlock()
+	s.mux.Lock()
+	s.schedule()
+	s.mux.Unlock()
+
+	<-t.run
+	c.l.Lock()
+}
+
+func (c *cond) Broadcast() {
+	s := c.s
+	s.mux.Lock()
+	s.runnable = append(s.runnable, c.waiters...)
+	c.waiters = nil
+	s.mux.Unlock()
+}
+
+// Explore will run fn once per seed as a subtest, seeds 1 through n are explored
+// unless the -sim.seeds flag is set. A failing subtest logs the flag which replays
+// it, -sim.seed runs that seed alone
+func Explore(t *testing.T, n int, fn func(t *testing.T, s *Sim)) {
+	first, last := int64(1), int64(n)
+	switch {
+	case *seedFlag != 0:
+		first, last = *seedFlag, *seedFlag
+	case *seedsFlag > 0:
+		last = int64(*seedsFlag)
+	}
+
+	for seed := first; seed <= last; seed++ {
+		ok := t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			fn(t, New(seed))
+		})
+
+		if !ok {
+			t.Logf("Replay with: go test -run '%s' -sim.seed=%d", t.Name(), seed)
+			return
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sim
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// run will run three goroutines which each yield a few times and return the trace
+func run(t *testing.T, seed int64) []int {
+	s := New(seed)
+	for i := 0; i < 3; i++ {
+		s.Go(func() {
+			for j := 0; j < 4; j++ {
+				s.Yield()
+			}
+		})
+	}
+
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	return s.Trace()
+}
+
+func TestReplay(t *testing.T) {
+	a, b := run(t, 42), run(t, 42)
+	if !slices.Equal(a, b) {
+		t.Fatal("Seed did not replay", a, b)
+	}
+
+	// Some seed must produce a different interleaving
+	for seed := int64(1); seed < 16; seed++ {
+		if !slices.Equal(a, run(t, seed)) {
+			return
+		}
+	}
+
+	t.Fatal("Every seed produced the same interleaving", a)
+}
+
+func TestCond(t *testing.T) {
+	var (
+		mux   sync.Mutex
+		ready bool
+		woken int
+	)
+
+	s := New(1)
+	c := s.NewCond(&mux)
+	for i := 0; i < 2; i++ {
+		s.Go(func() {
+			mux.Lock()
+			for !ready {
+				c.Wait()
+			}
+
+			woken++
+			mux.Unlock()
+		})
+	}
+
+	s.Go(func() {
+		s.Yield()
+		mux.Lock()
+		ready = true
+		c.Broadcast()
+		mux.Unlock()
+	})
+
+	if err := s.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if woken != 2 {
+		t.Fatal("Invalid number of woken goroutines", woken)
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	var mux sync.Mutex
+	s := New(1)
+	c := s.NewCond(&mux)
+	s.Go(func() {
+		mux.Lock()
+		// Nobody will broadcast
+		c.Wait()
+		mux.Unlock()
+	})
+
+	if err := s.Run(); !errors.Is(err, ErrDeadlock) {
+		t.Fatal("Invalid error returned", err)
+	}
+}
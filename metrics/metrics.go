@@ -0,0 +1,214 @@
+// Package metrics exports mailbox statistics through expvar and the Prometheus
+// text exposition format, without any third-party dependency.
+//
+//	reg := metrics.NewRegistry()
+//	reg.Register("jobs", jobs)
+//	reg.Publish("mailboxes")
+//	http.Handle("/metrics", reg)
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+// NewRegistry returns a new instance of Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		boxes: make(map[string]*mailbox.Mailbox),
+	}
+}
+
+// Registry holds named mailboxes whose statistics are exported
+type Registry struct {
+	mux   sync.RWMutex
+	boxes map[string]*mailbox.Mailbox
+}
+
+// Register will register a mailbox under the provided name, replacing any
+// mailbox previously registered under the same name
+func (r *Registry) Register(name string, mb *mailbox.Mailbox) {
+	r.mux.Lock()
+	r.boxes[name] = mb
+	r.mux.Unlock()
+}
+
+// Unregister will remove the mailbox registered under the provided name
+func (r *Registry) Unregister(name string) {
+	r.mux.Lock()
+	delete(r.boxes, name)
+	r.mux.Unlock()
+}
+
+// Snapshot will return the statistics of all registered mailboxes
+func (r *Registry) Snapshot() (stats map[string]mailbox.Stats) {
+	r.mux.RLock()
+	stats = make(map[string]mailbox.Stats, len(r.boxes))
+	for name, mb := range r.boxes {
+		stats[name] = mb.Stats()
+	}
+
+	r.mux.RUnlock()
+	return
+}
+
+// Publish will publish the statistics of all registered mailboxes as an expvar
+// variable with the provided name
+// Note: As with expvar.Publish, Publish panics if the name is already in use
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return r.Snapshot()
+	}))
+}
+
+// metric describes a single exported metric
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(s *mailbox.Stats) float64
+}
+
+var metrics = []metric{
+	{"mailbox_depth", "gauge", "Current number of messages in the mailbox.", func(s *mailbox.Stats) float64 { return float64(s.Len) }},
+	{"mailbox_max_depth", "gauge", "Largest number of messages the mailbox has held.", func(s *mailbox.Stats) float64 { return float64(s.MaxLen) }},
+	{"mailbox_capacity", "gauge", "Capacity of the mailbox.", func(s *mailbox.Stats) float64 { return float64(s.Cap) }},
+	{"mailbox_sent_total", "counter", "Total number of messages sent.", func(s *mailbox.Stats) float64 { return float64(s.Sent) }},
+	{"mailbox_received_total", "counter", "Total number of messages received.", func(s *mailbox.Stats) float64 { return float64(s.Received) }},
+	{"mailbox_dropped_total", "counter", "Total number of messages dropped by controlled delay before being received.", func(s *mailbox.Stats) float64 { return float64(s.Dropped) }},
+	{"mailbox_shed_total", "counter", "Total number of sends rejected by load shedding.", func(s *mailbox.Stats) float64 { return float64(s.Shed) }},
+	{"mailbox_blocked_senders", "gauge", "Number of senders waiting for a vacant entry.", func(s *mailbox.Stats) float64 { return float64(s.BlockedSenders) }},
+	{"mailbox_blocked_receivers", "gauge", "Number of receivers waiting for a message.", func(s *mailbox.Stats) float64 { return float64(s.BlockedReceivers) }},
+	{"mailbox_closed", "gauge", "Whether or not the mailbox is closed.", func(s *mailbox.Stats) float64 {
+		if s.Closed {
+			return 1
+		}
+
+		return 0
+	}},
+}
+
+// ServeHTTP will write the statistics of all registered mailboxes in the
+// Prometheus text exposition format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Expose(w)
+}
+
+// Expose will write the statistics of all registered mailboxes in the
+// Prometheus text exposition format
+func (r *Registry) Expose(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	stats := r.Snapshot()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+
+	// Sort our names so that output is stable between scrapes
+	sort.Strings(names)
+
+	for _, m := range metrics {
+		w.WriteString("# HELP " + m.name + " " + m.help + "\n")
+		w.WriteString("# TYPE " + m.name + " " + m.kind + "\n")
+		for _, name := range names {
+			s := stats[name]
+			writeSample(w, m.name, name, m.value(&s))
+		}
+	}
+
+	writeSojourn(w, names, stats)
+	return w.Flush()
+}
+
+// sojournBounds are the upper bounds of the exported sojourn histogram buckets. The
+// buckets of a mailbox histogram are attributed by their upper bound, so an exported
+// bucket never counts a duration above its bound, while durations up to 12.5% below
+// the bound may be counted by the next bucket
+var sojournBounds = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// writeSojourn will write the sojourn histogram of every mailbox which tracks sojourn times
+func writeSojourn(w *bufio.Writer, names []string, stats map[string]mailbox.Stats) {
+	const metric = "mailbox_sojourn_seconds"
+	var header bool
+	for _, name := range names {
+		h := stats[name].Sojourn
+		if h.Count() == 0 {
+			// Mailbox does not track sojourn times, or has yet to receive a message
+			continue
+		}
+
+		if !header {
+			w.WriteString("# HELP " + metric + " Time messages spent in the mailbox before being received.\n")
+			w.WriteString("# TYPE " + metric + " histogram\n")
+			header = true
+		}
+
+		// Accumulate the mailbox buckets into our fixed buckets
+		counts := make([]uint64, len(sojournBounds))
+		h.ForEach(func(_, upper time.Duration, n uint64) (end bool) {
+			// Buckets above our largest bound are only counted by +Inf
+			for i, bound := range sojournBounds {
+				if upper <= bound {
+					counts[i] += n
+					break
+				}
+			}
+
+			return
+		})
+
+		var cum uint64
+		for i, bound := range sojournBounds {
+			cum += counts[i]
+			writeBucket(w, metric, name, strconv.FormatFloat(bound.Seconds(), 'g', -1, 64), cum)
+		}
+
+		writeBucket(w, metric, name, "+Inf", h.Count())
+		writeSample(w, metric+"_sum", name, h.Sum().Seconds())
+		writeSample(w, metric+"_count", name, float64(h.Count()))
+	}
+}
+
+func writeBucket(w *bufio.Writer, metric, name, le string, count uint64) {
+	w.WriteString(metric)
+	w.WriteString(`_bucket{mailbox="`)
+	w.WriteString(labelEscaper.Replace(name))
+	w.WriteString(`",le="`)
+	w.WriteString(le)
+	w.WriteString(`"} `)
+	w.WriteString(strconv.FormatUint(count, 10))
+	w.WriteByte('\n')
+}
+
+func writeSample(w *bufio.Writer, metric, name string, value float64) {
+	w.WriteString(metric)
+	w.WriteString(`{mailbox="`)
+	w.WriteString(labelEscaper.Replace(name))
+	w.WriteString(`"} `)
+	w.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+func TestRegistry(t *testing.T) {
+	mb := mailbox.New(4)
+	mb.Send(1, false)
+	mb.Send(2, false)
+	mb.Receive(false)
+
+	r := NewRegistry()
+	r.Register(`jobs "a"`, mb)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, expected := range []string{
+		"# TYPE mailbox_depth gauge\n",
+		`mailbox_depth{mailbox="jobs \"a\""} 1` + "\n",
+		`mailbox_capacity{mailbox="jobs \"a\""} 4` + "\n",
+		"# TYPE mailbox_sent_total counter\n",
+		`mailbox_sent_total{mailbox="jobs \"a\""} 2` + "\n",
+		`mailbox_received_total{mailbox="jobs \"a\""} 1` + "\n",
+		`mailbox_closed{mailbox="jobs \"a\""} 0` + "\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected output to contain %q\n%s", expected, body)
+		}
+	}
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatal("invalid content type", ct)
+	}
+
+	r.Unregister(`jobs "a"`)
+	if len(r.Snapshot()) != 0 {
+		t.Fatal("expected mailbox to be unregistered")
+	}
+}
+
+// publishes is the number of TestRegistryPublish runs, expvar names cannot be reused
+// within a process so every run (e.g. with -count) publishes under its own name
+var publishes int
+
+func TestRegistryPublish(t *testing.T) {
+	mb := mailbox.New(4)
+	mb.Send(1, false)
+
+	r := NewRegistry()
+	r.Register("jobs", mb)
+	publishes++
+	name := "mailboxes_test_" + strconv.Itoa(publishes)
+	r.Publish(name)
+
+	var stats map[string]mailbox.Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats["jobs"].Len != 1 {
+		t.Fatal("invalid published stats", stats)
+	}
+}
+
+func TestRegistrySojourn(t *testing.T) {
+	now := time.Unix(0, 0)
+	mb := mailbox.NewWithOptions(4, mailbox.Options{
+		TrackSojourn: true,
+		Clock:        func() time.Time { return now },
+	})
+
+	mb.Send(1, false)
+	mb.Send(2, false)
+	now = now.Add(2 * time.Millisecond)
+	mb.Receive(false)
+	mb.Receive(false)
+	// Our bucket for 990µs extends past 1ms, so it is exported as below 5ms
+	mb.Send(3, false)
+	now = now.Add(990 * time.Microsecond)
+	mb.Receive(false)
+
+	r := NewRegistry()
+	r.Register("jobs", mb)
+	r.Register("untracked", mailbox.New(1))
+
+	var sb strings.Builder
+	if err := r.Expose(&sb); err != nil {
+		t.Fatal(err)
+	}
+
+	body := sb.String()
+	for _, expected := range []string{
+		"# TYPE mailbox_sojourn_seconds histogram\n",
+		`mailbox_sojourn_seconds_bucket{mailbox="jobs",le="0.0005"} 0` + "\n",
+		`mailbox_sojourn_seconds_bucket{mailbox="jobs",le="0.001"} 0` + "\n",
+		`mailbox_sojourn_seconds_bucket{mailbox="jobs",le="0.005"} 3` + "\n",
+		`mailbox_sojourn_seconds_bucket{mailbox="jobs",le="+Inf"} 3` + "\n",
+		`mailbox_sojourn_seconds_sum{mailbox="jobs"} 0.00499` + "\n",
+		`mailbox_sojourn_seconds_count{mailbox="jobs"} 3` + "\n",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("expected output to contain %q\n%s", expected, body)
+		}
+	}
+
+	if strings.Contains(body, `mailbox_sojourn_seconds_count{mailbox="untracked"}`) {
+		t.Fatal("untracked mailbox should not export a sojourn histogram")
+	}
+}
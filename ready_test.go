@@ -0,0 +1,74 @@
+package mailbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadyToReceive(t *testing.T) {
+	mb := New(2)
+	ready := mb.ReadyToReceive()
+	select {
+	case <-ready:
+		t.Fatal("Empty mailbox should not be ready to receive")
+	default:
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mb.Send(1, false)
+	}()
+
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("Readiness was not notified")
+	}
+
+	if _, state := mb.Receive(false); state != StateOK {
+		t.Fatal("Invalid state code returned", state)
+	}
+
+	mb.Close()
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("Close was not notified")
+	}
+}
+
+func TestReadyToSend(t *testing.T) {
+	mb := New(1)
+	// Vacant mailbox starts out ready
+	select {
+	case <-mb.ReadyToSend():
+	default:
+		t.Fatal("Vacant mailbox should be ready to send")
+	}
+
+	mb.Send(1, false)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mb.Receive(false)
+	}()
+
+	select {
+	case <-mb.ReadyToSend():
+	case <-time.After(time.Second):
+		t.Fatal("Readiness was not notified")
+	}
+
+	if state := mb.Send(2, false); state != StateOK {
+		t.Fatal("Invalid state code returned", state)
+	}
+}
+
+func TestReadyToReceivePrimed(t *testing.T) {
+	mb := New(1)
+	mb.Send(1, false)
+	select {
+	case <-mb.ReadyToReceive():
+	default:
+		t.Fatal("Mailbox with a message should start out ready to receive")
+	}
+}
@@ -0,0 +1,490 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+	"github.com/joeshaw/gengen/generic"
+)
+
+const (
+	// DialTimeout bounds the time taken to connect and complete the handshake
+	DialTimeout = 5 * time.Second
+
+	// minBackoff is the initial delay between reconnection attempts
+	minBackoff = 10 * time.Millisecond
+	// maxBackoff is the maximum delay between reconnection attempts
+	maxBackoff = 2 * time.Second
+)
+
+// ErrDisconnected is returned when a client has been disconnected
+var ErrDisconnected = errors.New("remote: disconnected")
+
+// Dial will connect to a named mailbox served over TCP
+func Dial(addr, name string, codec Codec) (*Client, error) {
+	return DialNetwork("tcp", addr, name, codec)
+}
+
+// DialUnix will connect to a named mailbox served over a Unix domain socket
+func DialUnix(path, name string, codec Codec) (*Client, error) {
+	return DialNetwork("unix", path, name, codec)
+}
+
+// DialNetwork will connect to a named mailbox served over the provided network
+func DialNetwork(network, addr, name string, codec Codec) (cp *Client, err error) {
+	var h handshake
+	c := Client{
+		network: network,
+		addr:    addr,
+		name:    name,
+		codec:   codec,
+		pending: make(map[uint64]*call),
+	}
+
+	c.cc = sync.NewCond(&c.mux)
+	if h, err = c.dial(); err != nil {
+		return
+	}
+
+	c.mux.Lock()
+	c.install(h)
+	c.mux.Unlock()
+	return &c, nil
+}
+
+// Client is a remote mailbox, it behaves like a local mailbox:
+//   - Sends are subject to flow control, a client holds a number of credits granted
+//     by the server (See Server.SetWindow). Every in-flight send consumes a credit,
+//     when no credits are available a non-waiting send will return StateFull and a
+//     waiting send will block until a credit is returned. A non-waiting send which
+//     is granted a credit returns StateFull when the hosted mailbox is full
+//   - StateClosed is reported once the remote mailbox is closed
+//   - Lost connections are re-established transparently, requests which were in-flight
+//     are re-sent once the connection is re-established. As a result, a send which was
+//     in-flight during a disconnect may be delivered more than once, while receives
+//     are at-most-once: a message taken from the remote mailbox for a receive which
+//     was in-flight during a disconnect is lost
+//   - Once the remote mailbox has been reported closed, a lost connection is not
+//     re-established and in-flight requests are returned StateClosed
+type Client struct {
+	mux sync.Mutex
+	// cc is used to signal available credits
+	cc *sync.Cond
+
+	network string
+	addr    string
+	name    string
+	codec   Codec
+
+	nc net.Conn
+	w  *bufio.Writer
+	// gen is incremented every time a new connection is established
+	gen int
+
+	window  int
+	credits int
+
+	id      uint64
+	pending map[uint64]*call
+
+	// closed is set when the remote mailbox reports it has been closed
+	closed bool
+	// disconnected is set when the client has been disconnected by the caller
+	disconnected bool
+	// lost is set when the connection was lost and will not be re-established
+	lost bool
+
+	err error
+}
+
+// call is an in-flight request
+type call struct {
+	req  frame
+	resp chan frame
+}
+
+// handshake is an established connection, ready to be installed
+type handshake struct {
+	nc     net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	window int
+}
+
+// dial will establish a connection and perform the handshake, the lock is not held
+// so that callers are not held up by a slow (or unreachable) server
+func (c *Client) dial() (h handshake, err error) {
+	var (
+		f      frame
+		window uint64
+	)
+
+	if h.nc, err = net.DialTimeout(c.network, c.addr, DialTimeout); err != nil {
+		return
+	}
+
+	// Bound the handshake as well, the deadline is cleared once it completes
+	h.nc.SetDeadline(time.Now().Add(DialTimeout))
+	h.r = bufio.NewReader(h.nc)
+	h.w = bufio.NewWriter(h.nc)
+	if err = writeFrame(h.w, frame{op: opHello, payload: []byte(c.name)}); err != nil {
+		goto FAIL
+	}
+
+	if f, err = readFrame(h.r); err != nil {
+		goto FAIL
+	}
+
+	if f.op != opHello {
+		err = errors.New(string(f.payload))
+		goto FAIL
+	}
+
+	if window, _ = binary.Uvarint(f.payload); window == 0 {
+		err = ErrInvalidFrame
+		goto FAIL
+	}
+
+	h.window = int(window)
+	h.nc.SetDeadline(time.Time{})
+	return
+
+FAIL:
+	h.nc.Close()
+	return
+}
+
+// install will swap in an established connection and start reading from it
+// Note: Lock is expected to be held when calling
+func (c *Client) install(h handshake) {
+	// Update our credits to reflect the window granted by the server, credits
+	// currently consumed by in-flight requests remain consumed
+	c.credits += h.window - c.window
+	c.window = h.window
+	c.nc = h.nc
+	c.w = h.w
+	c.gen++
+	c.cc.Broadcast()
+
+	go c.read(h.r, c.gen)
+}
+
+// read will read responses until the connection breaks
+func (c *Client) read(r *bufio.Reader, gen int) {
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			c.reconnect(gen, err)
+			return
+		}
+
+		c.mux.Lock()
+		if (f.op == opState || f.op == opMessage) && mailbox.StateCode(f.arg) == mailbox.StateClosed {
+			// Recorded before the connection can be lost, so that reconnect sees it
+			c.setState(mailbox.StateClosed)
+		}
+
+		cl, ok := c.pending[f.id]
+		delete(c.pending, f.id)
+		c.mux.Unlock()
+
+		if ok {
+			cl.resp <- f
+		}
+	}
+}
+
+// reconnect will re-establish a broken connection and re-send all in-flight requests
+func (c *Client) reconnect(gen int, err error) {
+	var h handshake
+	backoff := minBackoff
+	c.mux.Lock()
+	if gen != c.gen {
+		// Another reconnection has already taken place
+		c.mux.Unlock()
+		return
+	}
+
+	c.nc.Close()
+	c.err = err
+	if c.closed {
+		// Our mailbox has been closed (e.g. the server shut down), there is nothing
+		// left to reconnect to
+		c.lost = true
+		c.abandon()
+		c.mux.Unlock()
+		return
+	}
+
+	for !c.disconnected {
+		// Dial without the lock so that callers are not held up
+		c.mux.Unlock()
+		h, err = c.dial()
+		c.mux.Lock()
+		if err == nil {
+			break
+		}
+
+		c.err = err
+		// Release the lock while we back off so that callers are not held up
+		c.mux.Unlock()
+		time.Sleep(backoff)
+		c.mux.Lock()
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	defer c.mux.Unlock()
+	if c.disconnected {
+		if h.nc != nil {
+			// We were disconnected while dialing
+			h.nc.Close()
+		}
+
+		return
+	}
+
+	c.install(h)
+	// Re-send requests in the order they were issued
+	for id := uint64(1); id <= c.id; id++ {
+		if cl, ok := c.pending[id]; ok {
+			c.write(cl.req)
+		}
+	}
+}
+
+// write will write a frame to the current connection
+// Note: Lock is expected to be held when calling
+func (c *Client) write(f frame) {
+	if err := writeFrame(c.w, f); err != nil {
+		// The read loop will notice the broken connection and reconnect
+		c.err = err
+		c.nc.Close()
+	}
+}
+
+// do will issue a request and wait for the response
+// Note: Lock is expected to be held when calling, it will be held on return
+func (c *Client) do(f frame) (resp frame, ok bool) {
+	if c.lost {
+		return
+	}
+
+	c.id++
+	f.id = c.id
+	cl := call{req: f, resp: make(chan frame, 1)}
+	c.pending[f.id] = &cl
+	c.write(f)
+
+	c.mux.Unlock()
+	resp, ok = <-cl.resp
+	c.mux.Lock()
+
+	if ok && resp.op == opError {
+		c.err = errors.New(string(resp.payload))
+		ok = false
+	}
+
+	return
+}
+
+// acquire will acquire a send credit
+// Note: Lock is expected to be held when calling
+func (c *Client) acquire(wait bool) (state mailbox.StateCode) {
+	for c.credits == 0 {
+		if c.closed || c.disconnected {
+			return mailbox.StateClosed
+		}
+
+		if !wait {
+			return mailbox.StateFull
+		}
+
+		c.cc.Wait()
+	}
+
+	if c.closed || c.disconnected {
+		return mailbox.StateClosed
+	}
+
+	c.credits--
+	return
+}
+
+// release will return a send credit
+// Note: Lock is expected to be held when calling
+func (c *Client) release() {
+	c.credits++
+	c.cc.Signal()
+}
+
+func (c *Client) setState(state mailbox.StateCode) {
+	if state == mailbox.StateClosed {
+		c.closed = true
+		// Wake any senders waiting on credits
+		c.cc.Broadcast()
+	}
+}
+
+// Send will send a message
+func (c *Client) Send(msg generic.T, wait bool) (state mailbox.StateCode) {
+	var arg byte
+	payload, err := c.codec.Marshal(msg)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if err != nil {
+		c.err = err
+		return mailbox.StateClosed
+	}
+
+	if state = c.acquire(wait); state != mailbox.StateOK {
+		return
+	}
+
+	if wait {
+		arg = 1
+	}
+
+	resp, ok := c.do(frame{op: opSend, arg: arg, payload: payload})
+	c.release()
+	if !ok {
+		return mailbox.StateClosed
+	}
+
+	state = mailbox.StateCode(resp.arg)
+	c.setState(state)
+	return
+}
+
+// Batch will send a batch of messages
+func (c *Client) Batch(msgs ...generic.T) {
+	var payload []byte
+	for _, msg := range msgs {
+		b, err := c.codec.Marshal(msg)
+		if err != nil {
+			c.mux.Lock()
+			c.err = err
+			c.mux.Unlock()
+			return
+		}
+
+		payload = appendChunk(payload, b)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.acquire(true) != mailbox.StateOK {
+		return
+	}
+
+	resp, ok := c.do(frame{op: opBatch, payload: payload})
+	c.release()
+	if ok {
+		c.setState(mailbox.StateCode(resp.arg))
+	}
+}
+
+// Receive will receive a message and state (See the "State" constants for more information)
+func (c *Client) Receive(wait bool) (msg generic.T, state mailbox.StateCode) {
+	var arg byte
+	if wait {
+		arg = 1
+	}
+
+	c.mux.Lock()
+	if c.disconnected {
+		c.mux.Unlock()
+		return msg, mailbox.StateClosed
+	}
+
+	resp, ok := c.do(frame{op: opReceive, arg: arg})
+	c.mux.Unlock()
+	if !ok {
+		return msg, mailbox.StateClosed
+	}
+
+	if state = mailbox.StateCode(resp.arg); state != mailbox.StateOK {
+		return
+	}
+
+	msg, err := c.codec.Unmarshal(resp.payload)
+	if err != nil {
+		c.mux.Lock()
+		c.err = err
+		c.mux.Unlock()
+		state = mailbox.StateClosed
+	}
+
+	return
+}
+
+// Listen will return all current and inbound messages until either:
+//   - The mailbox is empty and closed
+//   - The end boolean is returned
+func (c *Client) Listen(fn func(msg generic.T) (end bool)) (state mailbox.StateCode) {
+	var msg generic.T
+	for {
+		if msg, state = c.Receive(true); state != mailbox.StateOK {
+			return
+		}
+
+		if fn(msg) {
+			return mailbox.StateEnded
+		}
+	}
+}
+
+// Close will close the remote mailbox
+// Note: The connection remains open so that remaining messages can be received,
+// call Disconnect to release the connection
+func (c *Client) Close() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.disconnected {
+		return
+	}
+
+	if _, ok := c.do(frame{op: opClose}); ok {
+		c.setState(mailbox.StateClosed)
+	}
+}
+
+// Disconnect will close the connection, in-flight requests are returned StateClosed
+func (c *Client) Disconnect() (err error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.disconnected {
+		return ErrDisconnected
+	}
+
+	c.disconnected = true
+	c.abandon()
+	return c.nc.Close()
+}
+
+// abandon will return StateClosed to all in-flight requests
+// Note: Lock is expected to be held when calling
+func (c *Client) abandon() {
+	for id, cl := range c.pending {
+		close(cl.resp)
+		delete(c.pending, id)
+	}
+
+	c.cc.Broadcast()
+}
+
+// Err will return the last transport or codec error encountered
+func (c *Client) Err() (err error) {
+	c.mux.Lock()
+	err = c.err
+	c.mux.Unlock()
+	return
+}
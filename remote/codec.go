@@ -0,0 +1,57 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+// ErrInvalidMessage is returned when a message cannot be handled by a codec
+var ErrInvalidMessage = errors.New("remote: invalid message")
+
+// Codec is used to encode and decode messages as they cross the wire
+type Codec interface {
+	Marshal(msg generic.T) ([]byte, error)
+	Unmarshal(b []byte) (msg generic.T, err error)
+}
+
+// GobCodec is a Codec backed by encoding/gob
+// Note: Concrete types sent as interface values must be registered with gob.Register
+type GobCodec struct{}
+
+// Marshal will encode a message
+func (GobCodec) Marshal(msg generic.T) (b []byte, err error) {
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(&msg); err != nil {
+		return
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal will decode a message
+func (GobCodec) Unmarshal(b []byte) (msg generic.T, err error) {
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(&msg)
+	return
+}
+
+// RawCodec is a Codec which passes []byte messages through untouched, it allows
+// a server to host opaque payloads without knowledge of their encoding
+type RawCodec struct{}
+
+// Marshal will return the message as bytes, the message must be a []byte
+func (RawCodec) Marshal(msg generic.T) (b []byte, err error) {
+	var ok bool
+	if b, ok = msg.([]byte); !ok {
+		err = ErrInvalidMessage
+	}
+
+	return
+}
+
+// Unmarshal will return the bytes as a message
+func (RawCodec) Unmarshal(b []byte) (msg generic.T, err error) {
+	return b, nil
+}
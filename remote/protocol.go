@@ -0,0 +1,118 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// opHello is sent by the client to attach to a named mailbox, the server
+	// replies with an opHello carrying the send window (credits) for the client
+	opHello byte = iota + 1
+	// opError is sent by the server when a request cannot be served
+	opError
+	// opSend requests a single message to be sent, arg holds the wait flag
+	opSend
+	// opBatch requests a batch of messages to be sent
+	opBatch
+	// opReceive requests a message to be received, arg holds the wait flag
+	opReceive
+	// opClose requests the mailbox to be closed
+	opClose
+	// opState is the response to opSend, opBatch and opClose, arg holds the state
+	opState
+	// opMessage is the response to opReceive, arg holds the state
+	opMessage
+)
+
+// maxPayload is the largest payload we will accept for a single frame
+const maxPayload = 64 << 20
+
+var (
+	// ErrPayloadTooLarge is returned when a frame exceeds the maximum payload size
+	ErrPayloadTooLarge = errors.New("remote: payload too large")
+	// ErrInvalidFrame is returned when a frame cannot be decoded
+	ErrInvalidFrame = errors.New("remote: invalid frame")
+)
+
+// frame is a single protocol unit, on the wire it is encoded as:
+//   - op (1 byte)
+//   - id (uvarint)
+//   - arg (1 byte)
+//   - payload length (uvarint)
+//   - payload
+type frame struct {
+	op      byte
+	id      uint64
+	arg     byte
+	payload []byte
+}
+
+func writeFrame(w *bufio.Writer, f frame) (err error) {
+	var buf [2*binary.MaxVarintLen64 + 2]byte
+	n := 0
+	buf[n] = f.op
+	n++
+	n += binary.PutUvarint(buf[n:], f.id)
+	buf[n] = f.arg
+	n++
+	n += binary.PutUvarint(buf[n:], uint64(len(f.payload)))
+
+	if _, err = w.Write(buf[:n]); err != nil {
+		return
+	}
+
+	if _, err = w.Write(f.payload); err != nil {
+		return
+	}
+
+	return w.Flush()
+}
+
+func readFrame(r *bufio.Reader) (f frame, err error) {
+	var plen uint64
+	if f.op, err = r.ReadByte(); err != nil {
+		return
+	}
+
+	if f.id, err = binary.ReadUvarint(r); err != nil {
+		return
+	}
+
+	if f.arg, err = r.ReadByte(); err != nil {
+		return
+	}
+
+	if plen, err = binary.ReadUvarint(r); err != nil {
+		return
+	}
+
+	if plen > maxPayload {
+		err = ErrPayloadTooLarge
+		return
+	}
+
+	f.payload = make([]byte, plen)
+	_, err = io.ReadFull(r, f.payload)
+	return
+}
+
+// appendChunk will append a length-prefixed chunk to the provided buffer
+func appendChunk(buf, chunk []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(chunk)))
+	return append(buf, chunk...)
+}
+
+// nextChunk will return the next length-prefixed chunk and the remaining buffer
+func nextChunk(buf []byte) (chunk, rest []byte, err error) {
+	n, sz := binary.Uvarint(buf)
+	if sz <= 0 || uint64(len(buf)-sz) < n {
+		err = ErrInvalidFrame
+		return
+	}
+
+	buf = buf[sz:]
+	return buf[:n], buf[n:], nil
+}
@@ -0,0 +1,490 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+	"github.com/joeshaw/gengen/generic"
+)
+
+var _ mailbox.Interface = (*Client)(nil)
+
+func TestClient(t *testing.T) {
+	var (
+		wg  sync.WaitGroup
+		cnt int
+	)
+
+	mb := mailbox.New(16)
+	addr := testServe(t, "test", mb)
+	c := testDial(t, addr, "test")
+	defer c.Disconnect()
+
+	wg.Add(1)
+	go func() {
+		c.Listen(func(msg generic.T) (end bool) {
+			if msg.(int) != cnt {
+				t.Errorf("invalid message, expected %d and received %v", cnt, msg)
+			}
+
+			cnt++
+			return
+		})
+
+		wg.Done()
+	}()
+
+	for i := 0; i < 256; i++ {
+		c.Send(i, true)
+	}
+
+	c.Close()
+	wg.Wait()
+
+	if cnt != 256 {
+		t.Fatal("invalid count", cnt)
+	}
+}
+
+func TestClientBatch(t *testing.T) {
+	mb := mailbox.New(16)
+	addr := testServe(t, "test", mb)
+	c := testDial(t, addr, "test")
+	defer c.Disconnect()
+
+	c.Batch(1, 2, 3)
+	for i := 1; i <= 3; i++ {
+		msg, state := mb.Receive(false)
+		if state != mailbox.StateOK {
+			t.Fatal("invalid state", state)
+		}
+
+		if msg.(int) != i {
+			t.Fatalf("invalid message, expected %d and received %v", i, msg)
+		}
+	}
+}
+
+func TestClientNoWait(t *testing.T) {
+	mb := mailbox.New(1)
+	addr := testServe(t, "test", mb)
+	c := testDial(t, addr, "test")
+	defer c.Disconnect()
+
+	if state := c.Send(1, false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	if state := c.Send(2, false); state != mailbox.StateFull {
+		t.Fatal("invalid state", state)
+	}
+
+	if _, state := c.Receive(false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	if _, state := c.Receive(false); state != mailbox.StateEmpty {
+		t.Fatal("invalid state", state)
+	}
+}
+
+func TestClientClosed(t *testing.T) {
+	mb := mailbox.New(1)
+	addr := testServe(t, "test", mb)
+	c := testDial(t, addr, "test")
+	defer c.Disconnect()
+
+	done := make(chan mailbox.StateCode)
+	go func() {
+		_, state := c.Receive(true)
+		done <- state
+	}()
+
+	// Close the mailbox locally, the blocked remote receiver should be notified
+	time.Sleep(10 * time.Millisecond)
+	mb.Close()
+
+	select {
+	case state := <-done:
+		if state != mailbox.StateClosed {
+			t.Fatal("invalid state", state)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("receiver was not notified of close")
+	}
+
+	if state := c.Send(1, true); state != mailbox.StateClosed {
+		t.Fatal("invalid state", state)
+	}
+}
+
+func TestClientDisconnectReceive(t *testing.T) {
+	mb := mailbox.New(1)
+	addr := testServe(t, "test", mb)
+	c := testDial(t, addr, "test")
+
+	done := make(chan mailbox.StateCode)
+	go func() {
+		_, state := c.Receive(true)
+		done <- state
+	}()
+
+	// Disconnect while the receive is blocked on the server
+	time.Sleep(10 * time.Millisecond)
+	c.Disconnect()
+	if state := <-done; state != mailbox.StateClosed {
+		t.Fatal("invalid state", state)
+	}
+
+	// Give the server a moment to notice the connection is gone
+	time.Sleep(10 * time.Millisecond)
+	if state := mb.Send(1, false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	// The abandoned receive must not take the message from local receivers
+	time.Sleep(10 * time.Millisecond)
+	if msg, state := mb.Receive(false); state != mailbox.StateOK || msg.(int) != 1 {
+		t.Fatal("invalid receive", msg, state)
+	}
+}
+
+func TestClientWindow(t *testing.T) {
+	mb := mailbox.New(16)
+	l := testListen(t)
+	srv := NewServer(GobCodec{})
+	srv.Handle("test", mb)
+	srv.SetWindow(1)
+	go srv.Serve(l)
+	c := testDial(t, l.Addr().String(), "test")
+	defer c.Disconnect()
+
+	c.mux.Lock()
+	window := c.window
+	c.mux.Unlock()
+	if window != 1 {
+		t.Fatal("invalid window", window)
+	}
+
+	if state := c.Send(1, false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+}
+
+func TestServerWindow(t *testing.T) {
+	mb := mailbox.New(1)
+	mb.Send([]byte("full"), false)
+	l := testListen(t)
+	srv := NewServer(RawCodec{})
+	srv.Handle("test", mb)
+	srv.SetWindow(1)
+	go srv.Serve(l)
+
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer nc.Close()
+	r, w := bufio.NewReader(nc), bufio.NewWriter(nc)
+	writeFrame(w, frame{op: opHello, payload: []byte("test")})
+	if f, err := readFrame(r); err != nil || f.op != opHello {
+		t.Fatal("invalid handshake", f, err)
+	}
+
+	// Our first send waits for room and holds the only credit, the second is beyond the window
+	writeFrame(w, frame{op: opSend, id: 1, arg: 1, payload: []byte("a")})
+	writeFrame(w, frame{op: opSend, id: 2, arg: 1, payload: []byte("b")})
+	f, err := readFrame(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.op != opError || f.id != 2 || string(f.payload) != ErrWindowExceeded.Error() {
+		t.Fatal("expected send beyond the window to be rejected", f)
+	}
+
+	// Once the first send completes its credit can be used again
+	mb.Receive(false)
+	if f, err = readFrame(r); err != nil || f.op != opState || f.id != 1 {
+		t.Fatal("invalid response", f, err)
+	}
+
+	mb.Receive(false)
+	writeFrame(w, frame{op: opSend, id: 3, arg: 1, payload: []byte("c")})
+	if f, err = readFrame(r); err != nil || f.op != opState || f.id != 3 || mailbox.StateCode(f.arg) != mailbox.StateOK {
+		t.Fatal("invalid response", f, err)
+	}
+}
+
+func TestClientDialUnlocked(t *testing.T) {
+	var first net.Conn
+	l := testListen(t)
+	srv := NewServer(GobCodec{})
+	srv.Handle("test", mailbox.New(16))
+	accepted := make(chan struct{})
+	go func() {
+		var err error
+		if first, err = l.Accept(); err != nil {
+			return
+		}
+
+		close(accepted)
+		go srv.serveConn(first)
+		// Accept reconnections but never answer their handshake
+		for {
+			if _, err = l.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+
+	c := testDial(t, l.Addr().String(), "test")
+	<-accepted
+	first.Close()
+	// Let the client start reconnecting, it is now stuck in the handshake
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		done <- c.Disconnect()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Disconnect was held up by reconnecting")
+	}
+}
+
+func TestClientUnknown(t *testing.T) {
+	addr := testServe(t, "test", mailbox.New(1))
+	if _, err := Dial(addr, "unknown", GobCodec{}); err == nil {
+		t.Fatal("expected error for unknown mailbox")
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	mb := mailbox.New(16)
+	l := testListener{Listener: testListen(t)}
+	go Serve(&l, "test", mb, GobCodec{})
+	c := testDial(t, l.Addr().String(), "test")
+	defer c.Disconnect()
+
+	if state := c.Send(1, true); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	// Break the connection from the server side
+	l.closeConns()
+
+	if state := c.Send(2, true); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	for i := 1; i <= 2; i++ {
+		msg, state := c.Receive(true)
+		if state != mailbox.StateOK {
+			t.Fatal("invalid state", state)
+		}
+
+		if msg.(int) != i {
+			t.Fatalf("invalid message, expected %d and received %v", i, msg)
+		}
+	}
+}
+
+func TestUnixOnDemand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mailboxd.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	srv := NewServer(RawCodec{})
+	srv.OnDemand(4)
+	go srv.Serve(l)
+
+	sender, err := DialUnix(path, "jobs", RawCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Disconnect()
+
+	receiver, err := DialUnix(path, "jobs", RawCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Disconnect()
+
+	done := make(chan mailbox.StateCode)
+	go func() {
+		done <- receiver.Listen(func(msg generic.T) (end bool) {
+			if string(msg.([]byte)) != "hello" {
+				t.Errorf("invalid message, expected hello and received %s", msg)
+			}
+
+			return
+		})
+	}()
+
+	if state := sender.Send([]byte("hello"), true); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	// Closing all mailboxes should notify the blocked listener
+	srv.CloseMailboxes()
+	if state := <-done; state != mailbox.StateClosed {
+		t.Fatal("invalid state", state)
+	}
+}
+
+func TestOnDemandDrop(t *testing.T) {
+	l := testListen(t)
+	srv := NewServer(GobCodec{})
+	srv.OnDemand(4)
+	go srv.Serve(l)
+
+	c := testDial(t, l.Addr().String(), "jobs")
+	defer c.Disconnect()
+	c.Close()
+
+	// Our closed and drained mailbox is forgotten, its name can be attached to again
+	srv.mux.Lock()
+	n := len(srv.boxes)
+	srv.mux.Unlock()
+	if n != 0 {
+		t.Fatal("invalid number of mailboxes", n)
+	}
+
+	c2 := testDial(t, l.Addr().String(), "jobs")
+	defer c2.Disconnect()
+	if state := c2.Send(1, false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	l := testListen(t)
+	srv := NewServer(GobCodec{})
+	srv.OnDemand(4)
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(l) }()
+
+	sender := testDial(t, l.Addr().String(), "jobs")
+	defer sender.Disconnect()
+	receiver := testDial(t, l.Addr().String(), "jobs")
+	defer receiver.Disconnect()
+
+	if state := sender.Send(1, false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
+	// Our queued message is still delivered, followed by StateClosed
+	if msg, state := receiver.Receive(true); state != mailbox.StateOK || msg != 1 {
+		t.Fatal("invalid receive", msg, state)
+	}
+
+	if _, state := receiver.Receive(true); state != mailbox.StateClosed {
+		t.Fatal("invalid state", state)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-served; err != ErrServerClosed {
+		t.Fatal("invalid serve error", err)
+	}
+
+	// Our connection is gone and is not re-established
+	if _, state := receiver.Receive(true); state != mailbox.StateClosed {
+		t.Fatal("invalid state", state)
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	l := testListen(t)
+	srv := NewServer(GobCodec{})
+	srv.OnDemand(4)
+	go srv.Serve(l)
+
+	c := testDial(t, l.Addr().String(), "jobs")
+	defer c.Disconnect()
+	c.Send(1, false)
+
+	// Nobody receives our message, the deadline closes the connection
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatal("invalid shutdown error", err)
+	}
+}
+
+func testListen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func testServe(t *testing.T, name string, mb *mailbox.Mailbox) (addr string) {
+	l := testListen(t)
+	go Serve(l, name, mb, GobCodec{})
+	return l.Addr().String()
+}
+
+func testDial(t *testing.T, addr, name string) *Client {
+	c, err := Dial(addr, name, GobCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+// testListener tracks accepted connections so that they can be broken
+type testListener struct {
+	net.Listener
+
+	mux   sync.Mutex
+	conns []net.Conn
+}
+
+func (l *testListener) Accept() (conn net.Conn, err error) {
+	if conn, err = l.Listener.Accept(); err != nil {
+		return
+	}
+
+	l.mux.Lock()
+	l.conns = append(l.conns, conn)
+	l.mux.Unlock()
+	return
+}
+
+func (l *testListener) closeConns() {
+	l.mux.Lock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+
+	l.conns = nil
+	l.mux.Unlock()
+}
@@ -0,0 +1,465 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+	"github.com/joeshaw/gengen/generic"
+)
+
+// DefaultWindow is the number of in-flight sends a client is granted
+const DefaultWindow = 64
+
+// shutdownPoll is the interval at which Shutdown checks for idle connections
+const shutdownPoll = 10 * time.Millisecond
+
+var (
+	// ErrUnknownMailbox is returned when a client attempts to attach to a mailbox which does not exist
+	ErrUnknownMailbox = errors.New("remote: unknown mailbox")
+	// ErrServerClosed is returned by Serve once Shutdown has been called
+	ErrServerClosed = errors.New("remote: server closed")
+	// ErrWindowExceeded is returned for sends beyond the window granted to a client
+	ErrWindowExceeded = errors.New("remote: send window exceeded")
+)
+
+// Serve will serve a single named mailbox on the provided listener
+// Serve blocks until the listener returns an error
+func Serve(l net.Listener, name string, mb *mailbox.Mailbox, codec Codec) error {
+	srv := NewServer(codec)
+	srv.Handle(name, mb)
+	return srv.Serve(l)
+}
+
+// NewServer returns a new instance of Server
+func NewServer(codec Codec) *Server {
+	return &Server{
+		codec:  codec,
+		window: DefaultWindow,
+		boxes:  make(map[string]*box),
+		lns:    make(map[net.Listener]struct{}),
+		conns:  make(map[*conn]struct{}),
+	}
+}
+
+// Server hosts named mailboxes for remote clients
+type Server struct {
+	mux sync.Mutex
+
+	codec  Codec
+	window int
+	boxes  map[string]*box
+	// size is the size of mailboxes created on demand, when zero clients may
+	// only attach to mailboxes which have been registered with Handle
+	size int
+
+	// lns and conns are the listeners being served and the live connections
+	lns   map[net.Listener]struct{}
+	conns map[*conn]struct{}
+	// shutdown is set once Shutdown has been called
+	shutdown bool
+}
+
+// box is a hosted mailbox
+type box struct {
+	name string
+	mb   *mailbox.Mailbox
+	// demand is set for mailboxes created on demand, they are dropped once closed and drained
+	demand bool
+}
+
+// receive will receive a message on behalf of a connection. A waiting receive is
+// abandoned once done is closed (when the connection goes away) so that it cannot
+// take a message which would never be delivered, gone is then true
+func (b *box) receive(done *mailbox.Mailbox, wait bool) (msg generic.T, state mailbox.StateCode, gone bool) {
+	if !wait {
+		msg, state = b.mb.Receive(false)
+		return
+	}
+
+	var chosen int
+	chosen, msg, state = mailbox.Select(mailbox.RecvCase(b.mb), mailbox.RecvCase(done))
+	gone = chosen == 1
+	return
+}
+
+// Handle will host a mailbox under the provided name
+func (s *Server) Handle(name string, mb *mailbox.Mailbox) {
+	s.mux.Lock()
+	s.boxes[name] = &box{name: name, mb: mb}
+	s.mux.Unlock()
+}
+
+// SetWindow will set the number of in-flight sends granted to each client connecting
+// from now on, DefaultWindow is used by default. The window is independent of the
+// size of the hosted mailbox: a non-waiting send returns StateFull either when the
+// client has no credits left or when the mailbox itself is full. Sends beyond the
+// window are rejected with ErrWindowExceeded
+func (s *Server) SetWindow(n int) {
+	if n < 1 {
+		panic("remote: window must be at least 1")
+	}
+
+	s.mux.Lock()
+	s.window = n
+	s.mux.Unlock()
+}
+
+// OnDemand will create mailboxes of the provided size when a client attaches to a
+// name which has not been registered
+func (s *Server) OnDemand(sz int) {
+	s.mux.Lock()
+	s.size = sz
+	s.mux.Unlock()
+}
+
+// CloseMailboxes will close all hosted mailboxes, clients are notified through
+// StateClosed once the remaining messages have been received
+func (s *Server) CloseMailboxes() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, b := range s.boxes {
+		b.mb.Close()
+	}
+}
+
+func (s *Server) get(name string) (b *box, ok bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if b, ok = s.boxes[name]; ok || s.size == 0 {
+		return
+	}
+
+	b = &box{name: name, mb: mailbox.New(s.size), demand: true}
+	s.boxes[name] = b
+	return b, true
+}
+
+// drop will forget a mailbox created on demand once it is closed and drained, so
+// that its name can be attached to again and names are not kept forever. Clients
+// which are still attached keep observing StateClosed
+func (s *Server) drop(b *box) {
+	if !b.demand {
+		return
+	}
+
+	if stats := b.mb.Stats(); !stats.Closed || stats.Len > 0 {
+		return
+	}
+
+	s.mux.Lock()
+	if s.boxes[b.name] == b {
+		delete(s.boxes, b.name)
+	}
+
+	s.mux.Unlock()
+}
+
+// Serve will accept connections on the provided listener until it returns an error,
+// ErrServerClosed is returned once Shutdown has been called
+func (s *Server) Serve(l net.Listener) (err error) {
+	var conn net.Conn
+	s.mux.Lock()
+	if s.shutdown {
+		s.mux.Unlock()
+		return ErrServerClosed
+	}
+
+	s.lns[l] = struct{}{}
+	s.mux.Unlock()
+
+	defer func() {
+		s.mux.Lock()
+		delete(s.lns, l)
+		if s.shutdown {
+			err = ErrServerClosed
+		}
+
+		s.mux.Unlock()
+	}()
+
+	for {
+		if conn, err = l.Accept(); err != nil {
+			return
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown will gracefully shut the server down: listeners are closed, hosted
+// mailboxes are closed and connections are closed once they are idle and their
+// mailbox has been drained, so that attached clients receive the remaining
+// messages followed by StateClosed. When ctx is done first, the remaining
+// connections are closed and ctx.Err() is returned
+func (s *Server) Shutdown(ctx context.Context) (err error) {
+	s.mux.Lock()
+	s.shutdown = true
+	for l := range s.lns {
+		l.Close()
+	}
+
+	for _, b := range s.boxes {
+		b.mb.Close()
+	}
+
+	s.mux.Unlock()
+
+	t := time.NewTicker(shutdownPoll)
+	defer t.Stop()
+	for !s.closeConns(false) {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			s.closeConns(true)
+			return ctx.Err()
+		}
+	}
+
+	return
+}
+
+// closeConns will close idle connections, or all of them when force is true. True
+// is returned when no connections remain
+func (s *Server) closeConns(force bool) (done bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for c := range s.conns {
+		if force || c.idle() {
+			c.nc.Close()
+			delete(s.conns, c)
+		}
+	}
+
+	return len(s.conns) == 0
+}
+
+// track will add a live connection, false is returned when the server is shutting down
+func (s *Server) track(c *conn) (ok bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.shutdown {
+		return false
+	}
+
+	s.conns[c] = struct{}{}
+	return true
+}
+
+func (s *Server) untrack(c *conn) {
+	s.mux.Lock()
+	delete(s.conns, c)
+	s.mux.Unlock()
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	c := conn{
+		nc:   nc,
+		r:    bufio.NewReader(nc),
+		w:    bufio.NewWriter(nc),
+		done: mailbox.New(1),
+	}
+	defer nc.Close()
+	// Closing done releases the receives which are waiting on behalf of this connection
+	defer c.done.Close()
+	if !s.track(&c) {
+		return
+	}
+
+	defer s.untrack(&c)
+	b, err := s.handshake(&c)
+	if err != nil {
+		return
+	}
+
+	c.box.Store(b)
+
+	for {
+		var f frame
+		if f, err = readFrame(c.r); err != nil {
+			return
+		}
+
+		if f.op == opSend || f.op == opBatch {
+			if c.sends.Load() >= int64(c.window) {
+				// Our client is sending more than its window allows
+				c.write(frame{op: opError, id: f.id, payload: []byte(ErrWindowExceeded.Error())})
+				continue
+			}
+
+			c.sends.Add(1)
+		}
+
+		// Requests are handled concurrently so that a blocking receive does not
+		// hold up sends from the same client
+		c.reqs.Add(1)
+		go func() {
+			defer c.reqs.Add(-1)
+			s.handle(&c, b, f)
+		}()
+	}
+}
+
+func (s *Server) handshake(c *conn) (b *box, err error) {
+	var (
+		f  frame
+		ok bool
+	)
+
+	if f, err = readFrame(c.r); err != nil {
+		return
+	}
+
+	if f.op != opHello {
+		err = ErrInvalidFrame
+		c.write(frame{op: opError, payload: []byte(err.Error())})
+		return
+	}
+
+	if b, ok = s.get(string(f.payload)); !ok {
+		err = ErrUnknownMailbox
+		c.write(frame{op: opError, payload: []byte(err.Error())})
+		return
+	}
+
+	s.mux.Lock()
+	c.window = s.window
+	s.mux.Unlock()
+	err = c.write(frame{op: opHello, payload: binary.AppendUvarint(nil, uint64(c.window))})
+	return
+}
+
+func (s *Server) handle(c *conn, b *box, f frame) {
+	switch f.op {
+	case opSend:
+		msg, err := s.codec.Unmarshal(f.payload)
+		if err != nil {
+			c.sent(frame{op: opError, id: f.id, payload: []byte(err.Error())})
+			return
+		}
+
+		state := b.mb.Send(msg, f.arg == 1)
+		c.sent(frame{op: opState, id: f.id, arg: byte(state)})
+
+	case opBatch:
+		msgs, err := s.decodeBatch(f.payload)
+		if err != nil {
+			c.sent(frame{op: opError, id: f.id, payload: []byte(err.Error())})
+			return
+		}
+
+		_, state := b.mb.BatchN(msgs, mailbox.BatchWait)
+		c.sent(frame{op: opState, id: f.id, arg: byte(state)})
+
+	case opReceive:
+		msg, state, gone := b.receive(c.done, f.arg == 1)
+		defer s.drop(b)
+		if gone {
+			// Our client went away while we were waiting, nothing was received
+			return
+		}
+
+		if state != mailbox.StateOK {
+			c.write(frame{op: opMessage, id: f.id, arg: byte(state)})
+			return
+		}
+
+		payload, err := s.codec.Marshal(msg)
+		if err != nil {
+			c.write(frame{op: opError, id: f.id, payload: []byte(err.Error())})
+			return
+		}
+
+		// Delivery is at-most-once, a message is lost when our client goes away
+		// before reading it (See Client)
+		c.write(frame{op: opMessage, id: f.id, payload: payload})
+
+	case opClose:
+		b.mb.Close()
+		s.drop(b)
+		c.write(frame{op: opState, id: f.id, arg: byte(mailbox.StateClosed)})
+
+	default:
+		c.write(frame{op: opError, id: f.id, payload: []byte(ErrInvalidFrame.Error())})
+	}
+}
+
+func (s *Server) decodeBatch(payload []byte) (msgs []generic.T, err error) {
+	var (
+		chunk []byte
+		msg   generic.T
+	)
+
+	for len(payload) > 0 {
+		if chunk, payload, err = nextChunk(payload); err != nil {
+			return
+		}
+
+		if msg, err = s.codec.Unmarshal(chunk); err != nil {
+			return
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return
+}
+
+// conn is a server-side connection
+type conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+	// done is closed once the connection is no longer read
+	done *mailbox.Mailbox
+	// box is the attached mailbox, set once the handshake completes
+	box atomic.Pointer[box]
+	// window is the number of in-flight sends granted to the client
+	window int
+	// reqs is the number of requests being handled, sends the number of sends among them
+	reqs  atomic.Int64
+	sends atomic.Int64
+
+	mux sync.Mutex
+	w   *bufio.Writer
+	err error
+}
+
+// idle will return whether or not the connection has no requests being handled and
+// its mailbox (if attached) is empty
+func (c *conn) idle() bool {
+	if c.reqs.Load() > 0 {
+		return false
+	}
+
+	b := c.box.Load()
+	return b == nil || b.mb.Len() == 0
+}
+
+// sent will complete a send with the provided response, the credit is returned
+// before responding so that our client may use it again as soon as it is told
+func (c *conn) sent(f frame) {
+	c.sends.Add(-1)
+	c.write(f)
+}
+
+func (c *conn) write(f frame) (err error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.err != nil {
+		// A previous write failed, this connection is no longer usable
+		return c.err
+	}
+
+	if err = writeFrame(c.w, f); err != nil {
+		c.err = err
+		c.nc.Close()
+	}
+
+	return
+}
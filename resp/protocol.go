@@ -0,0 +1,163 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// maxBulk is the largest bulk string we will accept
+const maxBulk = 16 << 20
+
+// maxArgs is the largest number of arguments we will accept for a single command
+const maxArgs = 64 << 10
+
+// maxLine is the longest line we will accept, it bounds inline commands
+const maxLine = 64 << 10
+
+// ErrProtocol is returned when a client sends malformed input
+var ErrProtocol = errors.New("resp: protocol error")
+
+// readCommand will read a single command, both RESP arrays of bulk strings and
+// inline commands are supported
+func readCommand(r *bufio.Reader) (args [][]byte, err error) {
+	var (
+		line []byte
+		n    int
+	)
+
+	if line, err = readLine(r); err != nil {
+		return
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		// Inline command, arguments are separated by spaces
+		return bytes.Fields(line), nil
+	}
+
+	if n, err = strconv.Atoi(string(line[1:])); err != nil || n < 0 || n > maxArgs {
+		return nil, ErrProtocol
+	}
+
+	// Our arguments grow as they are read rather than trusting the advertised count
+	args = make([][]byte, 0, min(n, 16))
+	for i := 0; i < n; i++ {
+		var arg []byte
+		if arg, err = readBulk(r); err != nil {
+			return
+		}
+
+		args = append(args, arg)
+	}
+
+	return
+}
+
+func readBulk(r *bufio.Reader) (b []byte, err error) {
+	var (
+		line []byte
+		n    int
+	)
+
+	if line, err = readLine(r); err != nil {
+		return
+	}
+
+	if len(line) == 0 || line[0] != '$' {
+		return nil, ErrProtocol
+	}
+
+	if n, err = strconv.Atoi(string(line[1:])); err != nil || n < 0 || n > maxBulk {
+		return nil, ErrProtocol
+	}
+
+	// Read the bulk string along with its trailing CRLF, it grows as it is read
+	// rather than trusting the advertised length
+	if b, err = io.ReadAll(io.LimitReader(r, int64(n)+2)); err != nil {
+		return
+	}
+
+	if len(b) != n+2 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	if b[n] != '\r' || b[n+1] != '\n' {
+		return nil, ErrProtocol
+	}
+
+	return b[:n], nil
+}
+
+// readLine will read a line terminated by CRLF (or LF) without its terminator
+func readLine(r *bufio.Reader) (line []byte, err error) {
+	var chunk []byte
+	for {
+		chunk, err = r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLine {
+			return nil, ErrProtocol
+		}
+
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			break
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	line = bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})
+	return
+}
+
+// writer encodes RESP replies
+type writer struct {
+	w *bufio.Writer
+}
+
+func (w *writer) simple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) error(s string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) integer(n int) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) bulk(b []byte) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(b)))
+	w.w.WriteString("\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) nilBulk() {
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	w.w.WriteByte('*')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) nilArray() {
+	w.w.WriteString("*-1\r\n")
+}
+
+func (w *writer) flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,29 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadCommandLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"too many arguments", "*100000\r\n", ErrProtocol},
+		{"bulk too large", "*1\r\n$99999999\r\n", ErrProtocol},
+		{"long line", strings.Repeat("a", maxLine+1) + "\r\n", ErrProtocol},
+		// Advertised sizes are not allocated up front, a short input fails once it ends
+		{"short arguments", "*60000\r\n$1\r\na\r\n", io.EOF},
+		{"short bulk", "*1\r\n$1000000\r\nabc", io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		if _, err := readCommand(bufio.NewReader(strings.NewReader(tt.input))); err != tt.err {
+			t.Fatalf("%s: expected %v and received %v", tt.name, tt.err, err)
+		}
+	}
+}
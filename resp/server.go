@@ -0,0 +1,306 @@
+// Package resp serves mailboxes through a subset of the Redis list commands so
+// that existing Redis clients can talk to them.
+//
+// Every key is a mailbox, mailboxes are created on first use. A mailbox is a
+// FIFO queue rather than a list, so both ends collapse onto it:
+//   - LPUSH and RPUSH send to the tail of the mailbox, waiting for room when it
+//     is full, and reply with the length of the mailbox
+//   - LPOP and RPOP receive from the head of the mailbox without waiting
+//   - BLPOP and BRPOP receive from the head of the first non-empty mailbox,
+//     waiting up to the provided timeout (0 waits forever)
+//   - LLEN replies with the length of the mailbox
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+const (
+	// maxTimeout is the longest wait of a blocking pop, longer timeouts are clamped
+	maxTimeout = 100 * 365 * 24 * time.Hour
+	// errValue is the reply to a pop of a value which is not a string
+	errValue = "ERR value is not a string"
+)
+
+// NewServer returns a new instance of Server, mailboxes are created with the provided size
+func NewServer(sz int) *Server {
+	return &Server{
+		size:  sz,
+		boxes: make(map[string]*mailbox.Mailbox),
+	}
+}
+
+// Server is a RESP server backed by mailboxes
+type Server struct {
+	mux   sync.Mutex
+	size  int
+	boxes map[string]*mailbox.Mailbox
+}
+
+// Mailbox will return the mailbox for the provided key, creating it if needed.
+// Values sent to it directly are popped when they are a []byte or a string, a pop
+// of any other value discards it and replies with an error
+func (s *Server) Mailbox(key string) (mb *mailbox.Mailbox) {
+	var ok bool
+	s.mux.Lock()
+	if mb, ok = s.boxes[key]; !ok {
+		mb = mailbox.New(s.size)
+		s.boxes[key] = mb
+	}
+
+	s.mux.Unlock()
+	return
+}
+
+// Serve will accept connections on the provided listener until it returns an error
+func (s *Server) Serve(l net.Listener) (err error) {
+	var conn net.Conn
+	for {
+		if conn, err = l.Accept(); err != nil {
+			return
+		}
+
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn will serve commands on the provided connection until it is closed
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	c := session{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    writer{w: bufio.NewWriter(conn)},
+	}
+
+	w := &c.w
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				w.error("ERR " + err.Error())
+				w.flush()
+			}
+
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		if !s.exec(&c, args) {
+			w.flush()
+			return
+		}
+
+		if err = w.flush(); err != nil {
+			return
+		}
+	}
+}
+
+// session is a client connection
+type session struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    writer
+}
+
+// watch will close the returned mailbox once the client closes the connection, so
+// that blocking commands can be abandoned. Stop ends the watch, it must be called
+// before the connection is read again
+// Note: A client which has pipelined further commands cannot be watched, its commands
+// are already buffered and gone is then never closed
+func (c *session) watch() (gone *mailbox.Mailbox, stop func()) {
+	gone = mailbox.New(1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := c.r.Peek(1); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			gone.Close()
+		}
+	}()
+
+	stop = func() {
+		// Interrupt our watch, then let the connection be read again
+		c.conn.SetReadDeadline(time.Now())
+		<-done
+		c.conn.SetReadDeadline(time.Time{})
+	}
+
+	return
+}
+
+// exec will execute a command, false is returned when the connection should be closed
+func (s *Server) exec(c *session, args [][]byte) (ok bool) {
+	w := &c.w
+	cmd := strings.ToUpper(string(args[0]))
+	args = args[1:]
+
+	switch cmd {
+	case "PING":
+		if len(args) > 0 {
+			w.bulk(args[0])
+		} else {
+			w.simple("PONG")
+		}
+
+	case "LPUSH", "RPUSH":
+		if len(args) < 2 {
+			w.error(errArgs(cmd))
+			break
+		}
+
+		s.push(w, string(args[0]), args[1:])
+
+	case "LPOP", "RPOP":
+		if len(args) != 1 {
+			w.error(errArgs(cmd))
+			break
+		}
+
+		s.pop(w, string(args[0]))
+
+	case "BLPOP", "BRPOP":
+		if len(args) < 2 {
+			w.error(errArgs(cmd))
+			break
+		}
+
+		timeout, err := strconv.ParseFloat(string(args[len(args)-1]), 64)
+		if err != nil || !(timeout >= 0) {
+			w.error("ERR timeout is not a float or out of range")
+			break
+		}
+
+		// Clamp our timeout so that its conversion cannot overflow, which would
+		// turn a long wait into an infinite one
+		s.bpop(c, args[:len(args)-1], time.Duration(min(timeout, maxTimeout.Seconds())*float64(time.Second)))
+
+	case "LLEN":
+		if len(args) != 1 {
+			w.error(errArgs(cmd))
+			break
+		}
+
+		w.integer(s.Mailbox(string(args[0])).Len())
+
+	case "COMMAND":
+		// Clients issue COMMAND on connect to discover the server, we have nothing to share
+		w.array(0)
+
+	case "QUIT":
+		w.simple("OK")
+		return false
+
+	default:
+		w.error("ERR unknown command '" + cmd + "'")
+	}
+
+	return true
+}
+
+func (s *Server) push(w *writer, key string, vals [][]byte) {
+	mb := s.Mailbox(key)
+	for _, val := range vals {
+		if mb.Send(val, true) == mailbox.StateClosed {
+			w.error("ERR mailbox closed")
+			return
+		}
+	}
+
+	w.integer(mb.Len())
+}
+
+func (s *Server) pop(w *writer, key string) {
+	msg, state := s.Mailbox(key).Receive(false)
+	if state != mailbox.StateOK {
+		w.nilBulk()
+		return
+	}
+
+	b, ok := toBytes(msg)
+	if !ok {
+		w.error(errValue)
+		return
+	}
+
+	w.bulk(b)
+}
+
+// bpop will pop from the first non-empty mailbox, waiting up to timeout. The pop is
+// abandoned when the client goes away, so that no message is taken on its behalf
+func (s *Server) bpop(c *session, keys [][]byte, timeout time.Duration) {
+	cases := make([]mailbox.Case, 0, len(keys)+2)
+	for _, key := range keys {
+		cases = append(cases, mailbox.RecvCase(s.Mailbox(string(key))))
+	}
+
+	gone, stop := c.watch()
+	defer stop()
+	cases = append(cases, mailbox.RecvCase(gone))
+	if timeout > 0 {
+		// Closing our timer mailbox fires its case
+		timer := mailbox.New(1)
+		t := time.AfterFunc(timeout, timer.Close)
+		defer t.Stop()
+		cases = append(cases, mailbox.RecvCase(timer))
+	}
+
+	chosen, msg, state := mailbox.Select(cases...)
+	if chosen >= len(keys) || state != mailbox.StateOK {
+		// Our client went away or our timeout expired
+		c.w.nilArray()
+		return
+	}
+
+	mb := cases[chosen].Mailbox
+	if _, state = gone.Receive(false); state == mailbox.StateClosed {
+		// Our client went away as the message arrived, put it back
+		mb.Send(msg, true)
+		return
+	}
+
+	b, ok := toBytes(msg)
+	if !ok {
+		c.w.error(errValue)
+		return
+	}
+
+	c.w.array(2)
+	c.w.bulk(keys[chosen])
+	c.w.bulk(b)
+	if err := c.w.flush(); err != nil {
+		// Our reply was not delivered, put the message back. It lands at the tail,
+		// a mailbox has no way to put it back at the head
+		mb.Send(msg, true)
+	}
+}
+
+// toBytes will return the bulk string of a message. Values sent to a mailbox by the
+// process hosting the server are accepted when they are a []byte or a string
+func toBytes(v any) (b []byte, ok bool) {
+	switch v := v.(type) {
+	case []byte:
+		return v, true
+	case string:
+		return []byte(v), true
+	}
+
+	return
+}
+
+func errArgs(cmd string) string {
+	return "ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command"
+}
@@ -0,0 +1,151 @@
+package resp
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	c := testDial(t, NewServer(4))
+
+	c.expect(t, ":3\r\n", "RPUSH", "jobs", "a", "b", "c")
+	c.expect(t, ":4\r\n", "LPUSH", "jobs", "d")
+	c.expect(t, ":4\r\n", "LLEN", "jobs")
+	c.expect(t, "$1\r\na\r\n", "LPOP", "jobs")
+	c.expect(t, "$1\r\nb\r\n", "RPOP", "jobs")
+	c.expect(t, "*2\r\n$4\r\njobs\r\n$1\r\nc\r\n", "BLPOP", "jobs", "0")
+	c.expect(t, "*2\r\n$4\r\njobs\r\n$1\r\nd\r\n", "BLPOP", "other", "jobs", "1")
+	c.expect(t, "$-1\r\n", "LPOP", "jobs")
+	c.expect(t, ":0\r\n", "LLEN", "jobs")
+	c.expect(t, "+PONG\r\n", "PING")
+	c.expect(t, "-ERR unknown command 'NOPE'\r\n", "NOPE")
+	c.expect(t, "-ERR wrong number of arguments for 'llen' command\r\n", "LLEN")
+}
+
+func TestServerBlockingPop(t *testing.T) {
+	srv := NewServer(4)
+	receiver := testDial(t, srv)
+	sender := testDial(t, srv)
+
+	receiver.send(t, "BLPOP", "jobs", "0")
+	time.Sleep(10 * time.Millisecond)
+	sender.expect(t, ":1\r\n", "RPUSH", "jobs", "hello")
+	receiver.read(t, "*2\r\n$4\r\njobs\r\n$5\r\nhello\r\n")
+}
+
+func TestServerBlockingPopDisconnect(t *testing.T) {
+	for _, keys := range [][]string{{"jobs"}, {"other", "jobs"}} {
+		srv := NewServer(4)
+		receiver := testDial(t, srv)
+		sender := testDial(t, srv)
+
+		receiver.send(t, append(append([]string{"BLPOP"}, keys...), "0")...)
+		time.Sleep(10 * time.Millisecond)
+		receiver.conn.Close()
+		time.Sleep(10 * time.Millisecond)
+
+		// Our message must not be taken on behalf of the closed connection
+		sender.expect(t, ":1\r\n", "RPUSH", "jobs", "hello")
+		time.Sleep(10 * time.Millisecond)
+		sender.expect(t, ":1\r\n", "LLEN", "jobs")
+		sender.expect(t, "$5\r\nhello\r\n", "LPOP", "jobs")
+	}
+}
+
+func TestServerBlockingPopTimeout(t *testing.T) {
+	c := testDial(t, NewServer(4))
+	start := time.Now()
+	c.expect(t, "*-1\r\n", "BLPOP", "jobs", "0.05")
+	if time.Since(start) < 50*time.Millisecond {
+		t.Fatal("blocking pop returned before the timeout")
+	}
+}
+
+func TestServerBlockingPopLongTimeout(t *testing.T) {
+	srv := NewServer(4)
+	c := testDial(t, srv)
+	c.expect(t, "-ERR timeout is not a float or out of range\r\n", "BLPOP", "jobs", "nan")
+
+	// Our timeout is clamped rather than overflowing
+	c.expect(t, ":1\r\n", "RPUSH", "jobs", "a")
+	c.expect(t, "*2\r\n$4\r\njobs\r\n$1\r\na\r\n", "BLPOP", "jobs", "1e300")
+}
+
+func TestServerForeignValues(t *testing.T) {
+	srv := NewServer(4)
+	c := testDial(t, srv)
+	mb := srv.Mailbox("jobs")
+	mb.Send("a", false)
+	mb.Send(1, false)
+	mb.Send(2, false)
+
+	c.expect(t, "$1\r\na\r\n", "LPOP", "jobs")
+	c.expect(t, "-"+errValue+"\r\n", "LPOP", "jobs")
+	c.expect(t, "-"+errValue+"\r\n", "BLPOP", "jobs", "0")
+}
+
+func TestServerInline(t *testing.T) {
+	c := testDial(t, NewServer(4))
+	c.w.WriteString("RPUSH jobs a\r\n")
+	c.w.Flush()
+	c.read(t, ":1\r\n")
+}
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func testDial(t *testing.T, srv *Server) *testClient {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+	go srv.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+func (c *testClient) send(t *testing.T, args ...string) {
+	c.w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		c.w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+
+	if err := c.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testClient) read(t *testing.T, expected string) {
+	buf := make([]byte, len(expected))
+	for i := range buf {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf[i] = b
+	}
+
+	if string(buf) != expected {
+		t.Fatalf("invalid reply, expected %q and received %q", expected, buf)
+	}
+}
+
+func (c *testClient) expect(t *testing.T, expected string, args ...string) {
+	c.send(t, args...)
+	c.read(t, expected)
+}
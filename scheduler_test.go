@@ -0,0 +1,60 @@
+package mailbox
+
+import (
+	"testing"
+
+	"github.com/itsmontoya/mailbox/mailboxtest/sim"
+	"github.com/joeshaw/gengen/generic"
+)
+
+func TestSimCloseBatch(t *testing.T) {
+	sim.Explore(t, 500, func(t *testing.T, s *sim.Sim) {
+		var (
+			sent     [2]int
+			received int
+			// queued is the length of the mailbox once closed, at is the received count at the time
+			queued int
+			at     int
+		)
+
+		mb := NewWithOptions(2, Options{Scheduler: s})
+		s.Go(func() {
+			sent[0], _ = mb.BatchN([]generic.T{1, 2, 3, 4}, BatchWait)
+		})
+
+		s.Go(func() {
+			sent[1], _ = mb.BatchN([]generic.T{5, 6}, BatchAtomic)
+		})
+
+		s.Go(func() {
+			for {
+				s.Yield()
+				if _, state := mb.Receive(true); state != StateOK {
+					return
+				}
+
+				received++
+			}
+		})
+
+		s.Go(func() {
+			s.Yield()
+			s.Yield()
+			mb.Close()
+			queued, at = mb.Len(), received
+		})
+
+		if err := s.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Nothing may be added once the mailbox is closed
+		if received-at != queued {
+			t.Fatalf("Received %d messages after close, %d were queued", received-at, queued)
+		}
+
+		if received != sent[0]+sent[1] {
+			t.Fatalf("Received %d messages, %d were sent", received, sent[0]+sent[1])
+		}
+	})
+}
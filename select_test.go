@@ -0,0 +1,110 @@
+package mailbox
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+func TestSelect(t *testing.T) {
+	var (
+		wg  sync.WaitGroup
+		cnt int
+	)
+
+	a := New(testBufSize)
+	b := New(testBufSize)
+	wg.Add(2)
+	for _, mb := range []*Mailbox{a, b} {
+		go func(mb *Mailbox) {
+			for _, si := range testSet {
+				mb.Send(si, true)
+			}
+
+			mb.Close()
+			wg.Done()
+		}(mb)
+	}
+
+	cases := []Case{RecvCase(a), RecvCase(b)}
+	for closed := 0; closed < 2; {
+		chosen, _, state := Select(cases...)
+		switch state {
+		case StateOK:
+			cnt++
+		case StateClosed:
+			// Replace the closed mailbox with one which will never be ready
+			cases[chosen] = RecvCase(New(1))
+			closed++
+		default:
+			t.Fatal("Invalid state code returned", state)
+		}
+	}
+
+	wg.Wait()
+	if cnt != len(testSet)*2 {
+		t.Fatal("Errr cnt", cnt)
+	}
+}
+
+func TestSelectDefault(t *testing.T) {
+	a := New(1)
+	chosen, _, state := Select(RecvCase(a), DefaultCase())
+	if chosen != 1 || state != StateOK {
+		t.Fatal("Expected default case to be chosen", chosen, state)
+	}
+
+	a.Send(1, false)
+	chosen, _, state = Select(SendCase(a, 2), DefaultCase())
+	if chosen != 1 || state != StateOK {
+		t.Fatal("Expected default case to be chosen", chosen, state)
+	}
+
+	chosen, msg, state := Select(RecvCase(a), DefaultCase())
+	if chosen != 0 || state != StateOK || msg != generic.T(1) {
+		t.Fatal("Expected receive case to be chosen", chosen, msg, state)
+	}
+}
+
+func TestSelectSend(t *testing.T) {
+	a := New(1)
+	b := New(1)
+	a.Send(1, false)
+	b.Send(1, false)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Receive(false)
+	}()
+
+	// Both mailboxes are full, the send case for b should fire once it has room
+	chosen, _, state := Select(SendCase(a, 2), SendCase(b, 2))
+	if chosen != 1 || state != StateOK {
+		t.Fatal("Expected send case for b to be chosen", chosen, state)
+	}
+
+	if a.Len() != 1 || b.Len() != 1 {
+		t.Fatal("Invalid mailbox lengths", a.Len(), b.Len())
+	}
+}
+
+func TestSelectFair(t *testing.T) {
+	a := New(testBufSize)
+	b := New(testBufSize)
+	var counts [2]int
+	for i := 0; i < testBufSize; i++ {
+		a.Send(i, false)
+		b.Send(i, false)
+	}
+
+	for i := 0; i < testBufSize; i++ {
+		chosen, _, _ := Select(RecvCase(a), RecvCase(b))
+		counts[chosen]++
+	}
+
+	if counts[0] == 0 || counts[1] == 0 {
+		t.Fatal("Expected both cases to be chosen", counts)
+	}
+}
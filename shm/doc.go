@@ -0,0 +1,25 @@
+// Package shm provides an inter-process ring buffer which lives in a memory
+// mapped file. It uses the same head/tail/len layout as mailbox.Mailbox, so
+// processes on the same host can send and receive messages without a syscall
+// on the fast path. Waiting is backed by futexes and is only available on Linux.
+//
+// Every slot holds a length-prefixed message of up to the slot size, which
+// allows both fixed-size and variable-size messages.
+//
+// Crash recovery:
+//   - The lock word holds the pid of its owner, a process which finds the lock
+//     held by a pid which no longer exists will take the lock over
+//   - Index updates are written to a journal before they are applied, the journal
+//     is replayed when the lock is taken over so a process which dies mid-operation
+//     leaves the ring either before or after the operation, never in between
+//   - A message which was being written or read when its process died is ignored,
+//     the operation simply did not happen
+//
+// Limits of crash recovery:
+//   - A dead owner is detected by its pid, a lock held by a process which died is
+//     not taken over while its pid has been reused by another live process. The
+//     ring then stays locked until that process exits
+//   - The waiter counts of a process which died while waiting are never decremented.
+//     They only gate wakeups, so the cost is a futex wakeup syscall per notify with
+//     no waiter left to wake, never a missed wakeup
+package shm
@@ -0,0 +1,32 @@
+//go:build linux
+
+package shm
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	// futexWait and futexWake are used without FUTEX_PRIVATE_FLAG as the futex
+	// words are shared between processes
+	futexWait = 0
+	futexWake = 1
+)
+
+// futexSleep will sleep while the value at addr equals val, for at most d
+func futexSleep(addr *uint32, val uint32, d time.Duration) {
+	ts := syscall.NsecToTimespec(int64(d))
+	syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), futexWait, uintptr(val), uintptr(unsafe.Pointer(&ts)), 0, 0)
+}
+
+// futexWakeup will wake up to n waiters sleeping on addr
+func futexWakeup(addr *uint32, n int) {
+	syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), futexWake, uintptr(n), 0, 0, 0)
+}
+
+// isAlive will return whether or not a process with the provided pid exists
+func isAlive(pid int) bool {
+	return syscall.Kill(pid, 0) != syscall.ESRCH
+}
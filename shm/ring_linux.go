@@ -0,0 +1,435 @@
+//go:build linux
+
+package shm
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+const (
+	magic   = 0x6d626f78 // "mbox"
+	version = 1
+)
+
+// Header layout, every field is a 32-bit word
+const (
+	offMagic    = 0
+	offVersion  = 4
+	offCap      = 8
+	offSlotSize = 12
+	// offLock holds the pid of the process which holds the lock, 0 when unlocked
+	offLock        = 16
+	offLockWaiters = 20
+	offLen         = 24
+	offHead        = 28
+	offTail        = 32
+	offClosed      = 36
+	// offRecvSeq is the futex word receivers wait on, it is incremented when the
+	// ring goes from empty to non-empty and when the ring is closed
+	offRecvSeq     = 40
+	offRecvWaiters = 44
+	// offSendSeq is the futex word senders wait on, it is incremented when the
+	// ring goes from full to non-full and when the ring is closed
+	offSendSeq     = 48
+	offSendWaiters = 52
+	// The journal holds index updates which are about to be applied
+	offJournalValid = 56
+	offJournalLen   = 60
+	offJournalHead  = 64
+	offJournalTail  = 68
+
+	headerSize = 128
+	// slotHeaderSize is the size of the length prefix of each slot
+	slotHeaderSize = 4
+)
+
+const (
+	// maxSpins is the number of times a locker will spin before sleeping
+	maxSpins = 64
+	// recheckInterval is the maximum time a waiter sleeps before checking again,
+	// it bounds the time it takes to notice a process which died holding the lock
+	recheckInterval = 10 * time.Millisecond
+)
+
+var (
+	// ErrInvalidFile is returned when a file is not a ring
+	ErrInvalidFile = errors.New("shm: invalid ring file")
+	// ErrInvalidSize is returned when a ring is created with an invalid size
+	ErrInvalidSize = errors.New("shm: slots and slot size must be greater than zero and the ring must not exceed MaxSize")
+)
+
+// MaxSize is the largest size of a ring file, including its header and slot prefixes
+const MaxSize = math.MaxInt32
+
+// Create will create a ring at the provided path with room for the provided number
+// of slots, each holding a message of up to slotSize bytes. The file holds a header
+// and a 4 byte prefix per slot, its total size must not exceed MaxSize
+// Note: An existing file at the path is truncated
+func Create(path string, slots, slotSize int) (rp *Ring, err error) {
+	var f *os.File
+	if slots <= 0 || slotSize <= 0 || slotSize > MaxSize-headerSize-slotHeaderSize {
+		return nil, ErrInvalidSize
+	}
+
+	// Guard the size of our file against overflow, Open rejects anything larger
+	if slots > (MaxSize-headerSize)/(slotHeaderSize+slotSize) {
+		return nil, ErrInvalidSize
+	}
+
+	if f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+		return
+	}
+
+	size := headerSize + slots*(slotHeaderSize+slotSize)
+	if err = f.Truncate(int64(size)); err != nil {
+		f.Close()
+		return
+	}
+
+	r, err := newRing(f, size)
+	if err != nil {
+		return
+	}
+
+	binary.LittleEndian.PutUint32(r.data[offVersion:], version)
+	binary.LittleEndian.PutUint32(r.data[offCap:], uint32(slots))
+	binary.LittleEndian.PutUint32(r.data[offSlotSize:], uint32(slotSize))
+	// Our tail starts one slot behind the head, the first send will move it to 0
+	binary.LittleEndian.PutUint32(r.data[offTail:], uint32(slots-1))
+	// Magic is written last so that a ring is never opened half-initialized
+	atomic.StoreUint32(r.word(offMagic), magic)
+
+	r.cap = uint32(slots)
+	r.slotSize = uint32(slotSize)
+	return r, nil
+}
+
+// Open will open an existing ring at the provided path
+func Open(path string) (rp *Ring, err error) {
+	var (
+		f  *os.File
+		fi os.FileInfo
+	)
+
+	if f, err = os.OpenFile(path, os.O_RDWR, 0); err != nil {
+		return
+	}
+
+	if fi, err = f.Stat(); err != nil {
+		f.Close()
+		return
+	}
+
+	if fi.Size() < headerSize || fi.Size() > MaxSize {
+		f.Close()
+		return nil, ErrInvalidFile
+	}
+
+	r, err := newRing(f, int(fi.Size()))
+	if err != nil {
+		return
+	}
+
+	r.cap = binary.LittleEndian.Uint32(r.data[offCap:])
+	r.slotSize = binary.LittleEndian.Uint32(r.data[offSlotSize:])
+	if atomic.LoadUint32(r.word(offMagic)) != magic ||
+		binary.LittleEndian.Uint32(r.data[offVersion:]) != version ||
+		r.cap == 0 ||
+		uint64(fi.Size()) != headerSize+uint64(r.cap)*uint64(slotHeaderSize+r.slotSize) {
+		r.Unmap()
+		return nil, ErrInvalidFile
+	}
+
+	return r, nil
+}
+
+func newRing(f *os.File, size int) (r *Ring, err error) {
+	var data []byte
+	if data, err = syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED); err != nil {
+		f.Close()
+		return
+	}
+
+	return &Ring{
+		f:    f,
+		data: data,
+		pid:  uint32(os.Getpid()),
+	}, nil
+}
+
+// Ring is a ring buffer shared between processes
+type Ring struct {
+	f    *os.File
+	data []byte
+	pid  uint32
+
+	cap      uint32
+	slotSize uint32
+}
+
+// word will return a pointer to the 32-bit word at the provided offset
+func (r *Ring) word(off int) *uint32 {
+	return (*uint32)(unsafe.Pointer(&r.data[off]))
+}
+
+func (r *Ring) load(off int) uint32 {
+	return atomic.LoadUint32(r.word(off))
+}
+
+func (r *Ring) store(off int, val uint32) {
+	atomic.StoreUint32(r.word(off), val)
+}
+
+// lock will acquire the inter-process lock, taking it over if its owner has died
+func (r *Ring) lock() {
+	lw := r.word(offLock)
+	for spins := 0; ; spins++ {
+		if atomic.CompareAndSwapUint32(lw, 0, r.pid) {
+			return
+		}
+
+		owner := atomic.LoadUint32(lw)
+		if owner == 0 {
+			// Lock was released in the meantime, try again
+			continue
+		}
+
+		if owner != r.pid && !isAlive(int(owner)) {
+			// Our owner died while holding the lock, take it over and recover
+			if atomic.CompareAndSwapUint32(lw, owner, r.pid) {
+				r.recover()
+				return
+			}
+
+			continue
+		}
+
+		if spins < maxSpins {
+			runtime.Gosched()
+			continue
+		}
+
+		atomic.AddUint32(r.word(offLockWaiters), 1)
+		futexSleep(lw, owner, recheckInterval)
+		atomic.AddUint32(r.word(offLockWaiters), ^uint32(0))
+	}
+}
+
+func (r *Ring) unlock() {
+	r.store(offLock, 0)
+	if r.load(offLockWaiters) > 0 {
+		futexWakeup(r.word(offLock), 1)
+	}
+}
+
+// recover will replay a journal left behind by a process which died mid-operation
+// Note: Lock is expected to be held when calling
+func (r *Ring) recover() {
+	if r.load(offJournalValid) == 0 {
+		// Our owner died before committing, nothing happened
+		return
+	}
+
+	r.apply()
+	r.store(offJournalValid, 0)
+}
+
+// commit will journal and apply new index values
+// Note: Lock is expected to be held when calling
+func (r *Ring) commit(len, head, tail uint32) {
+	r.store(offJournalLen, len)
+	r.store(offJournalHead, head)
+	r.store(offJournalTail, tail)
+	r.store(offJournalValid, 1)
+	r.apply()
+	r.store(offJournalValid, 0)
+}
+
+// apply will apply the journaled index values
+func (r *Ring) apply() {
+	r.store(offLen, r.load(offJournalLen))
+	r.store(offHead, r.load(offJournalHead))
+	r.store(offTail, r.load(offJournalTail))
+}
+
+// wait will release the lock and sleep until notified on the provided futex word
+// Note: Lock is expected to be held when calling, it will be held on return
+func (r *Ring) wait(seqOff, waitersOff int) {
+	seq := r.load(seqOff)
+	atomic.AddUint32(r.word(waitersOff), 1)
+	r.unlock()
+	futexSleep(r.word(seqOff), seq, recheckInterval)
+	atomic.AddUint32(r.word(waitersOff), ^uint32(0))
+	r.lock()
+}
+
+// notify will wake all waiters sleeping on the provided futex word
+func (r *Ring) notify(seqOff, waitersOff int) {
+	atomic.AddUint32(r.word(seqOff), 1)
+	if r.load(waitersOff) > 0 {
+		futexWakeup(r.word(seqOff), math.MaxInt32)
+	}
+}
+
+func (r *Ring) slot(i uint32) []byte {
+	off := headerSize + int(i)*(slotHeaderSize+int(r.slotSize))
+	return r.data[off : off+slotHeaderSize+int(r.slotSize)]
+}
+
+// Send will send a message, if the ring is full:
+//   - If wait is true, will wait for an available slot
+//   - Else, will return early with a state of StateFull
+//
+// A message which exceeds the slot size is not sent, StateRejected is returned
+func (r *Ring) Send(msg []byte, wait bool) (state mailbox.StateCode) {
+	if uint64(len(msg)) > uint64(r.slotSize) {
+		return mailbox.StateRejected
+	}
+
+	r.lock()
+	for {
+		if r.load(offClosed) == 1 {
+			state = mailbox.StateClosed
+			goto END
+		}
+
+		if r.load(offLen) < r.cap {
+			break
+		}
+
+		if !wait {
+			state = mailbox.StateFull
+			goto END
+		}
+
+		r.wait(offSendSeq, offSendWaiters)
+	}
+
+	r.send(msg)
+
+END:
+	r.unlock()
+	return
+}
+
+// send will write the message to the next slot and commit
+// Note: Lock is expected to be held when calling
+func (r *Ring) send(msg []byte) {
+	tail := r.load(offTail) + 1
+	if tail == r.cap {
+		// Our increment falls out of the bounds of our ring, reset to 0
+		tail = 0
+	}
+
+	// Write the message before committing, a crash at this point leaves the ring untouched
+	s := r.slot(tail)
+	binary.LittleEndian.PutUint32(s, uint32(len(msg)))
+	copy(s[slotHeaderSize:], msg)
+
+	n := r.load(offLen) + 1
+	r.commit(n, r.load(offHead), tail)
+	if n == 1 {
+		// Notify the receivers that we have a new message
+		r.notify(offRecvSeq, offRecvWaiters)
+	}
+}
+
+// Receive will receive a message and state (See the mailbox "State" constants for more information)
+func (r *Ring) Receive(wait bool) (msg []byte, state mailbox.StateCode) {
+	r.lock()
+	for r.load(offLen) == 0 {
+		if r.load(offClosed) == 1 {
+			// Our ring is empty AND closed, return StateClosed
+			state = mailbox.StateClosed
+			goto END
+		}
+
+		if !wait {
+			state = mailbox.StateEmpty
+			goto END
+		}
+
+		r.wait(offRecvSeq, offRecvWaiters)
+	}
+
+	msg = r.receive()
+
+END:
+	r.unlock()
+	return
+}
+
+// receive will copy the message out of the head slot and commit
+// Note: Lock is expected to be held when calling
+func (r *Ring) receive() (msg []byte) {
+	head := r.load(offHead)
+	s := r.slot(head)
+	n := binary.LittleEndian.Uint32(s)
+	if n > r.slotSize {
+		// A corrupt length can only be the result of tampering, cap it to the slot
+		n = r.slotSize
+	}
+
+	msg = make([]byte, n)
+	copy(msg, s[slotHeaderSize:])
+
+	if head++; head == r.cap {
+		head = 0
+	}
+
+	l := r.load(offLen)
+	r.commit(l-1, head, r.load(offTail))
+	if l == r.cap {
+		// Notify the senders that we have a vacant slot
+		r.notify(offSendSeq, offSendWaiters)
+	}
+
+	return
+}
+
+// Len will return the number of messages currently in the ring
+func (r *Ring) Len() int {
+	return int(r.load(offLen))
+}
+
+// Cap will return the number of slots in the ring
+func (r *Ring) Cap() int {
+	return int(r.cap)
+}
+
+// SlotSize will return the maximum message size
+func (r *Ring) SlotSize() int {
+	return int(r.slotSize)
+}
+
+// Close will close the ring for all processes, remaining messages can still be received
+func (r *Ring) Close() {
+	r.lock()
+	if r.load(offClosed) == 0 {
+		r.store(offClosed, 1)
+		r.notify(offSendSeq, offSendWaiters)
+		r.notify(offRecvSeq, offRecvWaiters)
+	}
+
+	r.unlock()
+}
+
+// Unmap will release this process' mapping of the ring, the ring itself is left untouched
+func (r *Ring) Unmap() (err error) {
+	if err = syscall.Munmap(r.data); err != nil {
+		return
+	}
+
+	r.data = nil
+	return r.f.Close()
+}
@@ -0,0 +1,177 @@
+//go:build linux
+
+package shm
+
+import (
+	"math"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+func TestRing(t *testing.T) {
+	var wg sync.WaitGroup
+	path := filepath.Join(t.TempDir(), "ring")
+	sender := testCreate(t, path, 8, 16)
+	receiver := testOpen(t, path)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1024; i++ {
+			if state := sender.Send([]byte(strconv.Itoa(i)), true); state != mailbox.StateOK {
+				t.Errorf("invalid state: %d", state)
+				return
+			}
+		}
+
+		sender.Close()
+	}()
+
+	var cnt int
+	for {
+		msg, state := receiver.Receive(true)
+		if state == mailbox.StateClosed {
+			break
+		}
+
+		if string(msg) != strconv.Itoa(cnt) {
+			t.Fatalf("invalid message, expected %d and received %s", cnt, msg)
+		}
+
+		cnt++
+	}
+
+	wg.Wait()
+	if cnt != 1024 {
+		t.Fatal("invalid count", cnt)
+	}
+}
+
+func TestRingNoWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	r := testCreate(t, path, 2, 4)
+
+	if state := r.Send([]byte("a"), false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	if state := r.Send([]byte("bb"), false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	if state := r.Send([]byte("c"), false); state != mailbox.StateFull {
+		t.Fatal("invalid state", state)
+	}
+
+	if msg, state := r.Receive(false); state != mailbox.StateOK || string(msg) != "a" {
+		t.Fatal("invalid receive", string(msg), state)
+	}
+
+	if msg, state := r.Receive(false); state != mailbox.StateOK || string(msg) != "bb" {
+		t.Fatal("invalid receive", string(msg), state)
+	}
+
+	if _, state := r.Receive(false); state != mailbox.StateEmpty {
+		t.Fatal("invalid state", state)
+	}
+}
+
+func TestRingTooLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	r := testCreate(t, path, 2, 4)
+	if state := r.Send([]byte("abcde"), true); state != mailbox.StateRejected {
+		t.Fatal("invalid state", state)
+	}
+
+	if n := r.Len(); n != 0 {
+		t.Fatal("invalid length", n)
+	}
+}
+
+func TestRingCreateInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	for _, tt := range [][2]int{
+		{0, 4},
+		{4, 0},
+		// A file Open would reject
+		{1 << 20, 1 << 12},
+		{2, math.MaxInt32},
+		// Our size overflows
+		{math.MaxInt, math.MaxInt},
+	} {
+		if _, err := Create(path, tt[0], tt[1]); err != ErrInvalidSize {
+			t.Fatal("expected ErrInvalidSize, received", tt, err)
+		}
+	}
+}
+
+func TestRingOpenInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	r := testCreate(t, path, 2, 4)
+	// Corrupt the magic
+	r.store(offMagic, 0)
+
+	if _, err := Open(path); err != ErrInvalidFile {
+		t.Fatal("expected ErrInvalidFile, received", err)
+	}
+}
+
+func TestRingRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring")
+	r := testCreate(t, path, 4, 4)
+	r.Send([]byte("a"), false)
+
+	// Simulate a process which died after journaling a send but before applying it
+	s := r.slot(1)
+	s[0], s[slotHeaderSize] = 1, 'b'
+	r.store(offJournalLen, 2)
+	r.store(offJournalHead, 0)
+	r.store(offJournalTail, 1)
+	r.store(offJournalValid, 1)
+	r.store(offLock, uint32(testDeadPid(t)))
+
+	if state := r.Send([]byte("c"), false); state != mailbox.StateOK {
+		t.Fatal("invalid state", state)
+	}
+
+	for _, expected := range []string{"a", "b", "c"} {
+		if msg, state := r.Receive(false); state != mailbox.StateOK || string(msg) != expected {
+			t.Fatalf("invalid receive, expected %s and received %s (%d)", expected, msg, state)
+		}
+	}
+}
+
+func testCreate(t *testing.T, path string, slots, slotSize int) *Ring {
+	r, err := Create(path, slots, slotSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { r.Unmap() })
+	return r
+}
+
+func testOpen(t *testing.T, path string) *Ring {
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { r.Unmap() })
+	return r
+}
+
+// testDeadPid will return the pid of a process which has exited
+func testDeadPid(t *testing.T) int {
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip("unable to spawn process:", err)
+	}
+
+	return cmd.Process.Pid
+}
@@ -0,0 +1,176 @@
+// Package slogh is an asynchronous slog.Handler backed by a mailbox.
+//
+// Records are queued by the logging goroutine and handed to an inner handler by a
+// background goroutine, so that callers never block on log I/O:
+//
+//	h := slogh.NewHandler(slog.NewJSONHandler(os.Stderr, nil), 1024, slogh.Drop)
+//	defer h.Close()
+//	slog.SetDefault(slog.New(h))
+//
+// Handlers derived with WithAttrs and WithGroup share the queue of their parent.
+package slogh
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+// ErrClosed is returned when a record is handled after the handler has been closed
+var ErrClosed = errors.New("slogh: handler is closed")
+
+// Policy is the behaviour of a handler when its queue is full
+type Policy uint8
+
+const (
+	// Block will wait for room in the queue, logging slows down to the speed of the inner handler
+	Block Policy = iota
+	// Drop will discard records which do not fit in the queue, see Dropped
+	Drop
+)
+
+// NewHandler returns a new Handler which queues up to size records for the inner handler
+// Size must be at least 1, NewHandler panics otherwise
+func NewHandler(inner slog.Handler, size int, policy Policy) *Handler {
+	if size < 1 {
+		panic("slogh: size must be at least 1")
+	}
+
+	q := queue{
+		mb:     mailbox.New(size),
+		policy: policy,
+		done:   make(chan struct{}),
+	}
+
+	go q.run()
+	return &Handler{inner: inner, q: &q}
+}
+
+// Handler is an asynchronous slog.Handler
+type Handler struct {
+	inner slog.Handler
+	q     *queue
+}
+
+// Enabled reports whether the inner handler handles records at the provided level
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+// Handle will queue a copy of the record for the inner handler. Errors returned by
+// the inner handler are not reported here, see Err
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	// Our record outlives this call, it must not share attributes with the caller and
+	// the inner handler must not observe the cancellation of the request context
+	it := item{h: h.inner, ctx: context.WithoutCancel(ctx), r: r.Clone()}
+	switch h.q.mb.Send(it, h.q.policy == Block) {
+	case mailbox.StateClosed:
+		return ErrClosed
+	case mailbox.StateFull:
+		h.q.dropped.Add(1)
+	}
+
+	return nil
+}
+
+// WithAttrs returns a handler whose inner handler has the provided attributes, it shares our queue
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{inner: h.inner.WithAttrs(attrs), q: h.q}
+}
+
+// WithGroup returns a handler whose inner handler has the provided group, it shares our queue
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{inner: h.inner.WithGroup(name), q: h.q}
+}
+
+// Flush will wait until every record queued before the call has been handled by
+// the inner handler, or until ctx is done
+func (h *Handler) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	// Our marker must not be dropped, wait for room unless ctx is done first
+	for {
+		state := h.q.mb.Send(flushed, false)
+		if state == mailbox.StateOK {
+			break
+		} else if state == mailbox.StateClosed {
+			return ErrClosed
+		}
+
+		select {
+		case <-h.q.mb.ReadyToSend():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close will stop accepting records and wait until every queued record has been
+// handled by the inner handler. Close is shared by derived handlers
+func (h *Handler) Close() error {
+	h.q.mb.Close()
+	<-h.q.done
+	return nil
+}
+
+// Dropped will return the number of records discarded because the queue was full
+func (h *Handler) Dropped() uint64 {
+	return h.q.dropped.Load()
+}
+
+// Err will return the last error returned by the inner handler, if any
+func (h *Handler) Err() (err error) {
+	h.q.mux.Lock()
+	err = h.q.err
+	h.q.mux.Unlock()
+	return
+}
+
+// item is a queued record along with the handler and context to handle it with
+type item struct {
+	h   slog.Handler
+	ctx context.Context
+	r   slog.Record
+}
+
+// queue is shared by a handler and all of its derived handlers
+type queue struct {
+	mb     *mailbox.Mailbox
+	policy Policy
+	// done is closed once the queue has been closed and drained
+	done    chan struct{}
+	dropped atomic.Uint64
+
+	mux sync.Mutex
+	err error
+}
+
+func (q *queue) run() {
+	// Receive rather than Listen so that the mailbox lock isn't held during I/O
+	for msg := range q.mb.All() {
+		switch v := msg.(type) {
+		case item:
+			if err := v.h.Handle(v.ctx, v.r); err != nil {
+				q.mux.Lock()
+				q.err = err
+				q.mux.Unlock()
+			}
+
+		case chan struct{}:
+			// Flush marker, every record before it has been handled
+			close(v)
+		}
+	}
+
+	close(q.done)
+}
@@ -0,0 +1,165 @@
+package slogh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a buffer which is safe to read while the handler writes
+type syncBuffer struct {
+	mux sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
+func TestHandler(t *testing.T) {
+	var buf syncBuffer
+	h := NewHandler(slog.NewTextHandler(&buf, nil), 16, Block)
+	log := slog.New(h).With("service", "jobs").WithGroup("req")
+	log.Info("first", "id", 1)
+	log.Warn("second", "id", 2)
+
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	if !strings.Contains(out, "msg=first service=jobs req.id=1") || !strings.Contains(out, "level=WARN msg=second") {
+		t.Fatal("invalid output", out)
+	}
+
+	if strings.Index(out, "first") > strings.Index(out, "second") {
+		t.Fatal("records were written out of order", out)
+	}
+
+	h.Close()
+	if err := h.Handle(context.Background(), slog.Record{}); err != ErrClosed {
+		t.Fatal("expected ErrClosed", err)
+	}
+}
+
+// blockingHandler blocks every record until released
+type blockingHandler struct {
+	slog.Handler
+	release chan struct{}
+}
+
+func (h *blockingHandler) Handle(ctx context.Context, r slog.Record) error {
+	<-h.release
+	return h.Handler.Handle(ctx, r)
+}
+
+func TestHandlerDrop(t *testing.T) {
+	var buf syncBuffer
+	inner := &blockingHandler{Handler: slog.NewTextHandler(&buf, nil), release: make(chan struct{})}
+	h := NewHandler(inner, 2, Drop)
+	log := slog.New(h)
+	// Two records fit in the queue (three if the consumer has already taken one), the rest are dropped
+	for i := 0; i < 10; i++ {
+		log.Info("record", "i", i)
+	}
+
+	if h.Dropped() < 7 || h.Dropped() > 8 {
+		t.Fatal("invalid dropped count", h.Dropped())
+	}
+
+	close(inner.release)
+	// Close drains the queue before returning
+	h.Close()
+	if n := strings.Count(buf.String(), "msg=record"); uint64(n)+h.Dropped() != 10 {
+		t.Fatal("records were lost", n, h.Dropped())
+	}
+}
+
+func TestHandlerFlushCanceled(t *testing.T) {
+	inner := &blockingHandler{Handler: slog.NewTextHandler(io.Discard, nil), release: make(chan struct{})}
+	h := NewHandler(inner, 4, Block)
+	slog.New(h).Info("record")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.Flush(ctx); err != context.Canceled {
+		t.Fatal("expected context.Canceled", err)
+	}
+
+	close(inner.release)
+	h.Close()
+}
+
+func TestHandlerFlushFullCanceled(t *testing.T) {
+	inner := &blockingHandler{Handler: slog.NewTextHandler(io.Discard, nil), release: make(chan struct{})}
+	h := NewHandler(inner, 1, Block)
+	log := slog.New(h)
+	// Our first record blocks the inner handler, the second fills the queue
+	log.Info("record")
+	log.Info("record")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs := make(chan error, 1)
+	go func() { errs <- h.Flush(ctx) }()
+
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Fatal("expected context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("flush waited for room past the cancellation of its context")
+	}
+
+	close(inner.release)
+	h.Close()
+}
+
+func TestHandlerFlushFull(t *testing.T) {
+	var buf syncBuffer
+	inner := &blockingHandler{Handler: slog.NewTextHandler(&buf, nil), release: make(chan struct{})}
+	h := NewHandler(inner, 1, Block)
+	log := slog.New(h)
+	log.Info("record")
+	log.Info("record")
+
+	// Our flush waits for room, then for both records to be handled
+	go close(inner.release)
+	if err := h.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := strings.Count(buf.String(), "msg=record"); n != 2 {
+		t.Fatal("records were not flushed", n)
+	}
+
+	h.Close()
+}
+
+func TestHandlerInvalidSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected invalid size to panic", size)
+				}
+			}()
+
+			NewHandler(slog.NewTextHandler(io.Discard, nil), size, Drop)
+		}()
+	}
+}
@@ -0,0 +1,74 @@
+package mailbox
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+func TestStats(t *testing.T) {
+	mb := New(2)
+	mb.Send(1, false)
+	mb.Send(2, false)
+	mb.Receive(false)
+
+	// Overwrite the oldest message
+	mb.mux.Lock()
+	mb.pop(3)
+	mb.pop(4)
+	mb.mux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		mb.Send(5, true)
+		close(done)
+	}()
+
+	// Wait for our sender to block
+	for mb.Stats().BlockedSenders != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	s := mb.Stats()
+	if s.Sent != 4 || s.Received != 1 || s.Dropped != 1 {
+		t.Fatal("Invalid counters", s)
+	}
+
+	if s.Len != 2 || s.MaxLen != 2 || s.Cap != 2 || s.Closed {
+		t.Fatal("Invalid depth", s)
+	}
+
+	mb.Close()
+	<-done
+	if s = mb.Stats(); s.BlockedSenders != 0 || !s.Closed {
+		t.Fatal("Invalid closed stats", s)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	mb := New(3)
+	if _, state := mb.Peek(); state != StateEmpty {
+		t.Fatal("Invalid state code returned", state)
+	}
+
+	// Wrap our ring around so that peeking crosses the end of the internal slice
+	mb.Send(0, false)
+	mb.Receive(false)
+	mb.Send(1, false)
+	mb.Send(2, false)
+	mb.Send(3, false)
+
+	if msg, state := mb.Peek(); state != StateOK || msg != generic.T(1) {
+		t.Fatal("Invalid peek", msg, state)
+	}
+
+	msgs := mb.PeekN(5)
+	if len(msgs) != 3 || msgs[0] != generic.T(1) || msgs[1] != generic.T(2) || msgs[2] != generic.T(3) {
+		t.Fatal("Invalid peek", msgs)
+	}
+
+	if mb.Len() != 3 || mb.Cap() != 3 {
+		t.Fatal("Peeking should not remove messages", mb.Len())
+	}
+}
@@ -0,0 +1,246 @@
+package stomp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxHeaders is the largest number of headers we will accept for a single frame
+	maxHeaders = 1024
+	// maxBody is the largest body we will accept for a single frame
+	maxBody = 64 << 20
+	// maxLine is the longest command or header line we will accept
+	maxLine = 64 << 10
+)
+
+var (
+	// ErrInvalidFrame is returned when a frame cannot be decoded
+	ErrInvalidFrame = errors.New("stomp: invalid frame")
+	// ErrBodyTooLarge is returned when a frame body exceeds the maximum size
+	ErrBodyTooLarge = errors.New("stomp: body too large")
+	// ErrLineTooLong is returned when a command or header line exceeds the maximum length
+	ErrLineTooLong = errors.New("stomp: line too long")
+)
+
+// Frame is a STOMP frame
+type Frame struct {
+	Command string
+	// Headers are kept in order, as STOMP 1.2 specifies the first occurrence of a
+	// repeated header wins
+	Headers [][2]string
+	Body    []byte
+}
+
+// Header will return the value of the first header with the provided key
+func (f *Frame) Header(key string) (val string, ok bool) {
+	for _, kv := range f.Headers {
+		if kv[0] == key {
+			return kv[1], true
+		}
+	}
+
+	return
+}
+
+// Get will return the value of the first header with the provided key, or an empty string
+func (f *Frame) Get(key string) (val string) {
+	val, _ = f.Header(key)
+	return
+}
+
+// Set will append a header
+func (f *Frame) Set(key, val string) {
+	f.Headers = append(f.Headers, [2]string{key, val})
+}
+
+// readFrame will read a frame, heart-beats (bare EOLs) preceding a frame are skipped
+func readFrame(r *bufio.Reader) (f Frame, err error) {
+	var line string
+	for {
+		if line, err = readLine(r); err != nil {
+			return
+		}
+
+		if line != "" {
+			break
+		}
+	}
+
+	f.Command = line
+	// CONNECT frames are not escaped
+	raw := f.Command == "CONNECT" || f.Command == "STOMP"
+	for {
+		if line, err = readLine(r); err != nil {
+			return
+		}
+
+		if line == "" {
+			break
+		}
+
+		if len(f.Headers) == maxHeaders {
+			err = ErrInvalidFrame
+			return
+		}
+
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			err = ErrInvalidFrame
+			return
+		}
+
+		key, val := line[:i], line[i+1:]
+		if !raw {
+			if key, err = unescape(key); err != nil {
+				return
+			}
+
+			if val, err = unescape(val); err != nil {
+				return
+			}
+		}
+
+		f.Set(key, val)
+	}
+
+	if cl, ok := f.Header("content-length"); ok {
+		var n int
+		if n, err = strconv.Atoi(cl); err != nil || n < 0 {
+			err = ErrInvalidFrame
+			return
+		}
+
+		if n > maxBody {
+			err = ErrBodyTooLarge
+			return
+		}
+
+		// Our body grows as it is read rather than trusting the advertised length
+		if f.Body, err = io.ReadAll(io.LimitReader(r, int64(n)+1)); err != nil {
+			return
+		}
+
+		if len(f.Body) != n+1 {
+			err = io.ErrUnexpectedEOF
+			return
+		}
+
+		if f.Body[n] != 0 {
+			err = ErrInvalidFrame
+			return
+		}
+
+		f.Body = f.Body[:n]
+		return
+	}
+
+	if f.Body, err = readDelim(r, 0, maxBody+1, ErrBodyTooLarge); err != nil {
+		return
+	}
+
+	f.Body = f.Body[:len(f.Body)-1]
+	return
+}
+
+// readLine will read a line terminated by LF or CRLF without its terminator
+func readLine(r *bufio.Reader) (line string, err error) {
+	var b []byte
+	if b, err = readDelim(r, '\n', maxLine, ErrLineTooLong); err != nil {
+		return
+	}
+
+	return strings.TrimSuffix(string(b[:len(b)-1]), "\r"), nil
+}
+
+// readDelim will read up to and including delim, errLimit is returned once more than
+// limit bytes have been read without finding it
+func readDelim(r *bufio.Reader, delim byte, limit int, errLimit error) (b []byte, err error) {
+	var chunk []byte
+	for {
+		chunk, err = r.ReadSlice(delim)
+		if len(b)+len(chunk) > limit {
+			return nil, errLimit
+		}
+
+		b = append(b, chunk...)
+		if err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}
+
+// writeFrame will encode a frame, CONNECT and CONNECTED frames are not escaped
+func writeFrame(w *bufio.Writer, f *Frame) error {
+	raw := f.Command == "CONNECT" || f.Command == "CONNECTED"
+	w.WriteString(f.Command)
+	w.WriteByte('\n')
+	for _, kv := range f.Headers {
+		if raw {
+			w.WriteString(kv[0])
+			w.WriteByte(':')
+			w.WriteString(kv[1])
+		} else {
+			w.WriteString(escape(kv[0]))
+			w.WriteByte(':')
+			w.WriteString(escape(kv[1]))
+		}
+
+		w.WriteByte('\n')
+	}
+
+	if len(f.Body) > 0 {
+		w.WriteString("content-length:")
+		w.WriteString(strconv.Itoa(len(f.Body)))
+		w.WriteByte('\n')
+	}
+
+	w.WriteByte('\n')
+	w.Write(f.Body)
+	w.WriteByte(0)
+	return w.Flush()
+}
+
+var escaper = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) (string, error) {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s, nil
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		if i++; i == len(s) {
+			return "", ErrInvalidFrame
+		}
+
+		switch s[i] {
+		case 'r':
+			buf.WriteByte('\r')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'c':
+			buf.WriteByte(':')
+		case '\\':
+			buf.WriteByte('\\')
+		default:
+			// STOMP 1.2 treats undefined escape sequences as fatal protocol errors
+			return "", ErrInvalidFrame
+		}
+	}
+
+	return buf.String(), nil
+}
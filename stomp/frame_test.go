@@ -0,0 +1,42 @@
+package stomp
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadFrameLimits(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{"long command", strings.Repeat("A", maxLine+1), ErrLineTooLong},
+		{"long header", "SEND\nkey:" + strings.Repeat("v", maxLine) + "\n\n\x00", ErrLineTooLong},
+		{"large content-length", "SEND\ncontent-length:" + "99999999999" + "\n\n\x00", ErrBodyTooLarge},
+		{"short body", "SEND\ncontent-length:10\n\nabc", io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		_, err := readFrame(bufio.NewReader(strings.NewReader(tt.input)))
+		if err != tt.err {
+			t.Fatalf("%s: invalid error %v", tt.name, err)
+		}
+	}
+}
+
+func TestReadDelim(t *testing.T) {
+	// Our reader buffers less than our input, so the delimiter is found across reads
+	r := bufio.NewReaderSize(strings.NewReader(strings.Repeat("a", 40)+"\x00"), 16)
+	b, err := readDelim(r, 0, 64, ErrBodyTooLarge)
+	if err != nil || len(b) != 41 {
+		t.Fatal("invalid read", len(b), err)
+	}
+
+	r = bufio.NewReaderSize(strings.NewReader(strings.Repeat("a", 40)+"\x00"), 16)
+	if _, err = readDelim(r, 0, 32, ErrBodyTooLarge); err != ErrBodyTooLarge {
+		t.Fatal("expected ErrBodyTooLarge, received", err)
+	}
+}
@@ -0,0 +1,664 @@
+// Package stomp is a STOMP 1.2 front-end for mailboxes.
+//
+// Destinations map to mailboxes, which are created on first use:
+//   - SEND sends the frame to the destination mailbox. When the mailbox is full
+//     the connection stops reading until room is available, which pushes the
+//     backpressure onto the client through TCP flow control
+//   - SUBSCRIBE starts a receive loop on the destination mailbox, messages are
+//     delivered as MESSAGE frames
+//   - The auto, client and client-individual ack modes are supported. In the
+//     client modes at most the prefetch number of messages are in-flight per
+//     subscription, NACK'd messages and messages which are still un-acknowledged
+//     when a subscription ends are sent back to the mailbox for redelivery. When
+//     the mailbox has been closed they are dropped, and a NACK or UNSUBSCRIBE
+//     which dropped messages is answered with an ERROR frame
+//   - Heart-beats are negotiated as described by the specification
+//
+// Transactions are not supported.
+package stomp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+const (
+	// DefaultHeartBeat is the default interval at which the server is willing to
+	// send and receive heart-beats
+	DefaultHeartBeat = 10 * time.Second
+	// DefaultPrefetch is the default number of un-acknowledged messages a client
+	// mode subscription may have in-flight
+	DefaultPrefetch = 32
+)
+
+const (
+	ackAuto             = "auto"
+	ackClient           = "client"
+	ackClientIndividual = "client-individual"
+)
+
+// NewServer returns a new instance of Server, mailboxes are created with the provided size
+func NewServer(sz int) *Server {
+	return &Server{
+		size:      sz,
+		heartBeat: DefaultHeartBeat,
+		prefetch:  DefaultPrefetch,
+		boxes:     make(map[string]*mailbox.Mailbox),
+	}
+}
+
+// Server is a STOMP server backed by mailboxes
+type Server struct {
+	mux   sync.Mutex
+	boxes map[string]*mailbox.Mailbox
+
+	size      int
+	heartBeat time.Duration
+	prefetch  int
+	sessions  uint64
+}
+
+// SetHeartBeat will set the interval at which the server is willing to send and
+// receive heart-beats, zero disables heart-beats
+func (s *Server) SetHeartBeat(d time.Duration) {
+	s.mux.Lock()
+	s.heartBeat = d
+	s.mux.Unlock()
+}
+
+// SetPrefetch will set the number of un-acknowledged messages a client mode
+// subscription may have in-flight, a value below 1 removes the limit
+func (s *Server) SetPrefetch(n int) {
+	s.mux.Lock()
+	s.prefetch = n
+	s.mux.Unlock()
+}
+
+// Mailbox will return the mailbox for the provided destination, creating it if needed.
+// Values sent to it directly are delivered when they are a []byte or a string, other
+// values are discarded
+func (s *Server) Mailbox(dest string) (mb *mailbox.Mailbox) {
+	var ok bool
+	s.mux.Lock()
+	if mb, ok = s.boxes[dest]; !ok {
+		mb = mailbox.New(s.size)
+		s.boxes[dest] = mb
+	}
+
+	s.mux.Unlock()
+	return
+}
+
+// Serve will accept connections on the provided listener until it returns an error
+func (s *Server) Serve(l net.Listener) (err error) {
+	var conn net.Conn
+	for {
+		if conn, err = l.Accept(); err != nil {
+			return
+		}
+
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn will serve the provided connection until it is closed
+func (s *Server) ServeConn(conn net.Conn) {
+	s.mux.Lock()
+	s.sessions++
+	ss := session{
+		s:        s,
+		id:       "session-" + strconv.FormatUint(s.sessions, 10),
+		conn:     conn,
+		r:        bufio.NewReader(conn),
+		w:        bufio.NewWriter(conn),
+		prefetch: s.prefetch,
+		subs:     make(map[string]*subscription),
+		acks:     make(map[string]*pending),
+		done:     make(chan struct{}),
+	}
+	s.mux.Unlock()
+
+	ss.serve()
+}
+
+// message is a message held in a mailbox
+type message struct {
+	headers [][2]string
+	body    []byte
+}
+
+// toMessage will return the message held by a mailbox. Values sent to a mailbox by
+// the process hosting the server are accepted as bodies when they are a []byte or
+// a string, ok is false for any other type
+func toMessage(v any) (msg *message, ok bool) {
+	switch v := v.(type) {
+	case *message:
+		return v, true
+	case []byte:
+		return &message{body: v}, true
+	case string:
+		return &message{body: []byte(v)}, true
+	}
+
+	return
+}
+
+// session is a client connection
+type session struct {
+	s    *Server
+	id   string
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmux      sync.Mutex
+	w         *bufio.Writer
+	lastWrite time.Time
+
+	mux      sync.Mutex
+	prefetch int
+	subs     map[string]*subscription
+	acks     map[string]*pending
+	msgID    uint64
+	closed   bool
+	done     chan struct{}
+	// in is the interval at which heart-beats are expected from the client
+	in time.Duration
+}
+
+// subscription is an active subscription
+type subscription struct {
+	id   string
+	dest string
+	mode string
+	mb   *mailbox.Mailbox
+	// cond signals room in the prefetch window, it uses the session lock
+	cond *sync.Cond
+	// stop is closed once the subscription is cancelled, it ends a waiting receive
+	stop *mailbox.Mailbox
+
+	unacked   []*pending
+	cancelled bool
+}
+
+// pending is a delivered message awaiting acknowledgement
+type pending struct {
+	id  string
+	sub *subscription
+	msg *message
+}
+
+var errDisconnect = errors.New("disconnect")
+
+func (ss *session) serve() {
+	defer ss.close()
+	if err := ss.connect(); err != nil {
+		ss.error(err.Error(), "")
+		return
+	}
+
+	for {
+		if ss.in > 0 {
+			// Allow for some tolerance before deciding our client is gone
+			ss.conn.SetReadDeadline(time.Now().Add(2 * ss.in))
+		}
+
+		f, err := readFrame(ss.r)
+		if err != nil {
+			return
+		}
+
+		if err = ss.handle(&f); err == errDisconnect {
+			return
+		} else if err != nil {
+			ss.error(err.Error(), f.Get("receipt"))
+			return
+		}
+
+		if receipt, ok := f.Header("receipt"); ok {
+			ss.write(&Frame{Command: "RECEIPT", Headers: [][2]string{{"receipt-id", receipt}}})
+		}
+	}
+}
+
+// connect will perform the CONNECT handshake and negotiate heart-beats
+func (ss *session) connect() (err error) {
+	var (
+		f      Frame
+		cx, cy time.Duration
+	)
+
+	if f, err = readFrame(ss.r); err != nil {
+		return
+	}
+
+	if f.Command != "CONNECT" && f.Command != "STOMP" {
+		return errors.New("expected CONNECT frame")
+	}
+
+	if !supports(f.Get("accept-version"), "1.2") {
+		ss.write(&Frame{Command: "ERROR", Headers: [][2]string{{"version", "1.2"}, {"message", "supported protocol versions are 1.2"}}})
+		return errDisconnect
+	}
+
+	if hb, ok := f.Header("heart-beat"); ok {
+		if cx, cy, err = parseHeartBeat(hb); err != nil {
+			return
+		}
+	}
+
+	ss.s.mux.Lock()
+	sx := ss.s.heartBeat
+	ss.s.mux.Unlock()
+
+	// We send every max(sx, cy) and expect to receive every max(cx, sx), provided
+	// both sides are willing
+	out := negotiate(sx, cy)
+	ss.in = negotiate(cx, sx)
+
+	resp := Frame{Command: "CONNECTED"}
+	resp.Set("version", "1.2")
+	resp.Set("session", ss.id)
+	resp.Set("server", "mailbox")
+	resp.Set("heart-beat", fmt.Sprintf("%d,%d", sx.Milliseconds(), sx.Milliseconds()))
+	if err = ss.write(&resp); err != nil {
+		return
+	}
+
+	if out > 0 {
+		go ss.heartBeat(out)
+	}
+
+	return
+}
+
+// heartBeat will send a heart-beat whenever the connection has been idle for the provided interval
+func (ss *session) heartBeat(interval time.Duration) {
+	t := time.NewTicker(interval / 2)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ss.done:
+			return
+		}
+
+		ss.wmux.Lock()
+		if time.Since(ss.lastWrite) >= interval/2 {
+			ss.w.WriteByte('\n')
+			ss.w.Flush()
+			ss.lastWrite = time.Now()
+		}
+
+		ss.wmux.Unlock()
+	}
+}
+
+func (ss *session) handle(f *Frame) (err error) {
+	switch f.Command {
+	case "SEND":
+		return ss.send(f)
+	case "SUBSCRIBE":
+		return ss.subscribe(f)
+	case "UNSUBSCRIBE":
+		return ss.unsubscribe(f)
+	case "ACK":
+		return ss.ack(f, false)
+	case "NACK":
+		return ss.ack(f, true)
+	case "DISCONNECT":
+		if receipt, ok := f.Header("receipt"); ok {
+			ss.write(&Frame{Command: "RECEIPT", Headers: [][2]string{{"receipt-id", receipt}}})
+		}
+
+		return errDisconnect
+	case "BEGIN", "COMMIT", "ABORT":
+		return errors.New("transactions are not supported")
+	default:
+		return fmt.Errorf("unknown command %q", f.Command)
+	}
+}
+
+func (ss *session) send(f *Frame) (err error) {
+	dest, ok := f.Header("destination")
+	if !ok {
+		return errors.New("missing destination header")
+	}
+
+	msg := message{body: f.Body}
+	for _, kv := range f.Headers {
+		switch kv[0] {
+		case "destination", "receipt", "content-length", "transaction":
+		default:
+			msg.headers = append(msg.headers, kv)
+		}
+	}
+
+	// Waiting here stops us from reading the socket, our client is throttled by
+	// TCP flow control until the mailbox has room
+	if ss.s.Mailbox(dest).Send(&msg, true) != mailbox.StateOK {
+		return errors.New("destination is closed")
+	}
+
+	return
+}
+
+func (ss *session) subscribe(f *Frame) (err error) {
+	id, ok := f.Header("id")
+	if !ok {
+		return errors.New("missing id header")
+	}
+
+	dest, ok := f.Header("destination")
+	if !ok {
+		return errors.New("missing destination header")
+	}
+
+	mode := f.Get("ack")
+	switch mode {
+	case "":
+		mode = ackAuto
+	case ackAuto, ackClient, ackClientIndividual:
+	default:
+		return fmt.Errorf("invalid ack mode %q", mode)
+	}
+
+	sub := subscription{
+		id:   id,
+		dest: dest,
+		mode: mode,
+		mb:   ss.s.Mailbox(dest),
+		cond: sync.NewCond(&ss.mux),
+		stop: mailbox.New(1),
+	}
+
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	if _, ok = ss.subs[id]; ok {
+		return fmt.Errorf("subscription %q already exists", id)
+	}
+
+	ss.subs[id] = &sub
+	go ss.listen(&sub)
+	return
+}
+
+func (ss *session) unsubscribe(f *Frame) (err error) {
+	id, ok := f.Header("id")
+	if !ok {
+		return errors.New("missing id header")
+	}
+
+	ss.mux.Lock()
+	sub, ok := ss.subs[id]
+	if !ok {
+		ss.mux.Unlock()
+		return fmt.Errorf("subscription %q does not exist", id)
+	}
+
+	delete(ss.subs, id)
+	unacked := ss.cancel(sub)
+	ss.mux.Unlock()
+
+	return requeue(unacked)
+}
+
+// cancel will cancel a subscription and return its un-acknowledged messages
+// Note: Lock is expected to be held when calling
+func (ss *session) cancel(sub *subscription) (unacked []*pending) {
+	sub.cancelled = true
+	sub.cond.Broadcast()
+	sub.stop.Close()
+	for _, p := range sub.unacked {
+		delete(ss.acks, p.id)
+	}
+
+	unacked = sub.unacked
+	sub.unacked = nil
+	return
+}
+
+// ack will acknowledge (or negatively acknowledge) a delivered message, in the
+// client ack mode all prior messages of the subscription are acknowledged as well
+func (ss *session) ack(f *Frame, nack bool) (err error) {
+	var (
+		done []*pending
+		id   string
+		ok   bool
+		p    *pending
+	)
+
+	if id, ok = f.Header("id"); !ok {
+		return errors.New("missing id header")
+	}
+
+	ss.mux.Lock()
+	if p, ok = ss.acks[id]; !ok {
+		ss.mux.Unlock()
+		return fmt.Errorf("unknown ack id %q", id)
+	}
+
+	sub := p.sub
+	for i, up := range sub.unacked {
+		if up != p {
+			continue
+		}
+
+		if sub.mode == ackClient {
+			// Cumulative, everything up to and including this message
+			done = append(done, sub.unacked[:i+1]...)
+			sub.unacked = append(sub.unacked[:0:0], sub.unacked[i+1:]...)
+		} else {
+			done = append(done, p)
+			sub.unacked = append(sub.unacked[:i:i], sub.unacked[i+1:]...)
+		}
+
+		break
+	}
+
+	for _, dp := range done {
+		delete(ss.acks, dp.id)
+	}
+
+	sub.cond.Broadcast()
+	ss.mux.Unlock()
+
+	if nack {
+		err = requeue(done)
+	}
+
+	return
+}
+
+// listen will deliver messages from the subscription's mailbox until it is cancelled
+func (ss *session) listen(sub *subscription) {
+	for {
+		ss.mux.Lock()
+		for !sub.cancelled && sub.mode != ackAuto && ss.prefetch > 0 && len(sub.unacked) >= ss.prefetch {
+			// Our prefetch window is full, wait for an acknowledgement
+			sub.cond.Wait()
+		}
+
+		cancelled := sub.cancelled
+		ss.mux.Unlock()
+		if cancelled {
+			return
+		}
+
+		// We receive one message at a time rather than using Listen, as Listen would
+		// hold the mailbox lock while we write to the socket. Selecting on stop ends
+		// our receive as soon as the subscription is cancelled, rather than taking a
+		// message from the other subscribers of our destination
+		chosen, msg, state := mailbox.Select(mailbox.RecvCase(sub.mb), mailbox.RecvCase(sub.stop))
+		if chosen != 0 || state != mailbox.StateOK {
+			return
+		}
+
+		m, ok := toMessage(msg)
+		if !ok {
+			// Our mailbox is exported, a value we cannot deliver is discarded
+			continue
+		}
+
+		if !ss.deliver(sub, m) {
+			return
+		}
+	}
+}
+
+// deliver will write a message to the client, false is returned when the subscription has ended
+func (ss *session) deliver(sub *subscription, msg *message) (ok bool) {
+	ss.mux.Lock()
+	if sub.cancelled {
+		ss.mux.Unlock()
+		// Our subscription ended as the message arrived, hand it back. It lands at
+		// the tail, there is no one left to report a closed mailbox to
+		sub.mb.Send(msg, true)
+		return false
+	}
+
+	ss.msgID++
+	id := ss.id + "-" + strconv.FormatUint(ss.msgID, 10)
+	if sub.mode != ackAuto {
+		p := pending{id: id, sub: sub, msg: msg}
+		sub.unacked = append(sub.unacked, &p)
+		ss.acks[id] = &p
+	}
+
+	ss.mux.Unlock()
+
+	f := Frame{Command: "MESSAGE", Body: msg.body}
+	f.Set("subscription", sub.id)
+	f.Set("message-id", id)
+	f.Set("destination", sub.dest)
+	if sub.mode != ackAuto {
+		f.Set("ack", id)
+	}
+
+	f.Headers = append(f.Headers, msg.headers...)
+	if err := ss.write(&f); err != nil {
+		if sub.mode == ackAuto {
+			// Our client never received the message, hand it back. Our connection is
+			// broken, there is no one left to report a closed mailbox to
+			sub.mb.Send(msg, true)
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func (ss *session) write(f *Frame) (err error) {
+	ss.wmux.Lock()
+	defer ss.wmux.Unlock()
+	if err = writeFrame(ss.w, f); err != nil {
+		// Our connection is broken, unblock our reader
+		ss.conn.Close()
+		return
+	}
+
+	ss.lastWrite = time.Now()
+	return
+}
+
+func (ss *session) error(msg, receipt string) {
+	f := Frame{Command: "ERROR"}
+	f.Set("message", msg)
+	if receipt != "" {
+		f.Set("receipt-id", receipt)
+	}
+
+	ss.write(&f)
+}
+
+// close will end all subscriptions and hand un-acknowledged messages back to their mailboxes
+func (ss *session) close() {
+	var unacked []*pending
+	ss.mux.Lock()
+	if ss.closed {
+		ss.mux.Unlock()
+		return
+	}
+
+	ss.closed = true
+	close(ss.done)
+	for id, sub := range ss.subs {
+		unacked = append(unacked, ss.cancel(sub)...)
+		delete(ss.subs, id)
+	}
+
+	ss.mux.Unlock()
+
+	ss.conn.Close()
+	// Our client is gone, messages whose mailbox has been closed are dropped
+	requeue(unacked)
+}
+
+// requeue will send messages back to their mailboxes for redelivery, an error is
+// returned when a mailbox has been closed and its messages were dropped
+func requeue(ps []*pending) (err error) {
+	var dropped int
+	for _, p := range ps {
+		if p.sub.mb.Send(p.msg, true) == mailbox.StateClosed {
+			dropped++
+		}
+	}
+
+	if dropped > 0 {
+		err = fmt.Errorf("destination is closed, %d messages were dropped", dropped)
+	}
+
+	return
+}
+
+func supports(versions, version string) bool {
+	for _, v := range strings.Split(versions, ",") {
+		if strings.TrimSpace(v) == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseHeartBeat(hb string) (cx, cy time.Duration, err error) {
+	var x, y int
+	parts := strings.Split(hb, ",")
+	if len(parts) != 2 {
+		err = errors.New("invalid heart-beat header")
+		return
+	}
+
+	if x, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil || x < 0 {
+		err = errors.New("invalid heart-beat header")
+		return
+	}
+
+	if y, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil || y < 0 {
+		err = errors.New("invalid heart-beat header")
+		return
+	}
+
+	return time.Duration(x) * time.Millisecond, time.Duration(y) * time.Millisecond, nil
+}
+
+// negotiate will return the negotiated heart-beat interval, zero when either side declines
+func negotiate(a, b time.Duration) time.Duration {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,274 @@
+package stomp
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/itsmontoya/mailbox"
+)
+
+func TestServer(t *testing.T) {
+	c := testConnect(t, NewServer(4), "0,0")
+	c.write(t, "SUBSCRIBE", "id:0", "destination:/queue/jobs")
+	c.write(t, "SEND", "destination:/queue/jobs", "content-type:text/plain", "", "hello")
+
+	f := c.read(t)
+	if f.Command != "MESSAGE" {
+		t.Fatal("expected MESSAGE frame, received", f.Command)
+	}
+
+	if string(f.Body) != "hello" {
+		t.Fatal("invalid body", string(f.Body))
+	}
+
+	if f.Get("subscription") != "0" || f.Get("destination") != "/queue/jobs" || f.Get("content-type") != "text/plain" {
+		t.Fatal("invalid headers", f.Headers)
+	}
+
+	if _, ok := f.Header("ack"); ok {
+		t.Fatal("auto subscriptions should not carry an ack header")
+	}
+}
+
+func TestServerClientIndividual(t *testing.T) {
+	srv := NewServer(4)
+	c := testConnect(t, srv, "0,0")
+	c.write(t, "SEND", "destination:q", "", "a")
+	c.write(t, "SEND", "destination:q", "", "b")
+	c.write(t, "SUBSCRIBE", "id:0", "destination:q", "ack:client-individual")
+
+	a := c.read(t)
+	b := c.read(t)
+	if string(a.Body) != "a" || string(b.Body) != "b" {
+		t.Fatal("invalid bodies", string(a.Body), string(b.Body))
+	}
+
+	// Acknowledge b, negatively acknowledge a which should be redelivered
+	c.write(t, "ACK", "id:"+b.Get("ack"))
+	c.write(t, "NACK", "id:"+a.Get("ack"))
+
+	f := c.read(t)
+	if string(f.Body) != "a" {
+		t.Fatal("expected redelivery of a, received", string(f.Body))
+	}
+}
+
+func TestServerClientPrefetch(t *testing.T) {
+	srv := NewServer(4)
+	srv.SetPrefetch(1)
+	c := testConnect(t, srv, "0,0")
+	c.write(t, "SEND", "destination:q", "", "a")
+	c.write(t, "SEND", "destination:q", "", "b")
+	c.write(t, "SUBSCRIBE", "id:0", "destination:q", "ack:client")
+
+	a := c.read(t)
+	// Our prefetch window is full, b must not be delivered until a is acknowledged
+	c.write(t, "SEND", "destination:other", "receipt:1", "", "x")
+	if f := c.read(t); f.Command != "RECEIPT" {
+		t.Fatal("expected RECEIPT frame, received", f.Command, string(f.Body))
+	}
+
+	c.write(t, "ACK", "id:"+a.Get("ack"))
+	if f := c.read(t); string(f.Body) != "b" {
+		t.Fatal("expected b, received", string(f.Body))
+	}
+}
+
+func TestServerUnsubscribeRedelivers(t *testing.T) {
+	srv := NewServer(4)
+	c := testConnect(t, srv, "0,0")
+	c.write(t, "SEND", "destination:q", "", "a")
+	c.write(t, "SUBSCRIBE", "id:0", "destination:q", "ack:client")
+	c.read(t)
+	c.write(t, "UNSUBSCRIBE", "id:0", "receipt:1")
+	c.read(t)
+
+	msg, _ := srv.Mailbox("q").Receive(false)
+	if msg == nil || string(msg.(*message).body) != "a" {
+		t.Fatal("un-acknowledged message was not handed back to the mailbox")
+	}
+}
+
+func TestServerUnsubscribeStopsReceive(t *testing.T) {
+	srv := NewServer(4)
+	c := testConnect(t, srv, "0,0")
+	c.write(t, "SUBSCRIBE", "id:0", "destination:q")
+	// Let our subscription start waiting on the empty mailbox
+	time.Sleep(10 * time.Millisecond)
+	c.write(t, "UNSUBSCRIBE", "id:0", "receipt:1")
+	c.read(t)
+
+	// Our ended subscription must not take messages from the mailbox
+	mb := srv.Mailbox("q")
+	mb.Send(&message{body: []byte("a")}, false)
+	mb.Send(&message{body: []byte("b")}, false)
+	time.Sleep(10 * time.Millisecond)
+	for _, expected := range []string{"a", "b"} {
+		msg, state := mb.Receive(false)
+		if state != mailbox.StateOK || string(msg.(*message).body) != expected {
+			t.Fatal("expected", expected, "received", msg, state)
+		}
+	}
+}
+
+func TestServerNackClosed(t *testing.T) {
+	srv := NewServer(4)
+	c := testConnect(t, srv, "0,0")
+	c.write(t, "SEND", "destination:q", "", "a")
+	c.write(t, "SUBSCRIBE", "id:0", "destination:q", "ack:client")
+	a := c.read(t)
+
+	// Our message cannot be handed back to a closed mailbox, the client is told so
+	srv.Mailbox("q").Close()
+	c.write(t, "NACK", "id:"+a.Get("ack"))
+	if f := c.read(t); f.Command != "ERROR" {
+		t.Fatal("expected ERROR frame, received", f.Command)
+	}
+}
+
+func TestServerPrefetchUnlimited(t *testing.T) {
+	srv := NewServer(4)
+	srv.SetPrefetch(0)
+	c := testConnect(t, srv, "0,0")
+	c.write(t, "SEND", "destination:q", "", "a")
+	c.write(t, "SEND", "destination:q", "", "b")
+	c.write(t, "SUBSCRIBE", "id:0", "destination:q", "ack:client")
+
+	for _, expected := range []string{"a", "b"} {
+		if f := c.read(t); string(f.Body) != expected {
+			t.Fatal("expected", expected, "received", string(f.Body))
+		}
+	}
+}
+
+func TestServerForeignValues(t *testing.T) {
+	srv := NewServer(4)
+	c := testConnect(t, srv, "0,0")
+	mb := srv.Mailbox("q")
+	mb.Send(1, false)
+	mb.Send("a", false)
+	mb.Send([]byte("b"), false)
+	c.write(t, "SUBSCRIBE", "id:0", "destination:q")
+
+	// Our int cannot be delivered and is discarded
+	for _, expected := range []string{"a", "b"} {
+		if f := c.read(t); string(f.Body) != expected {
+			t.Fatal("expected", expected, "received", string(f.Body))
+		}
+	}
+}
+
+func TestServerBackpressure(t *testing.T) {
+	srv := NewServer(1)
+	c := testConnect(t, srv, "0,0")
+	c.write(t, "SEND", "destination:q", "receipt:1", "", "a")
+	if f := c.read(t); f.Get("receipt-id") != "1" {
+		t.Fatal("expected receipt 1")
+	}
+
+	// The mailbox is full, this send should not be processed until room is available
+	c.write(t, "SEND", "destination:q", "receipt:2", "", "b")
+	c.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := readFrame(c.r); err == nil {
+		t.Fatal("send was processed while the mailbox was full")
+	}
+
+	c.conn.SetReadDeadline(time.Time{})
+	c.r.Reset(c.conn)
+	srv.Mailbox("q").Receive(false)
+	if f := c.read(t); f.Get("receipt-id") != "2" {
+		t.Fatal("expected receipt 2")
+	}
+}
+
+func TestServerHeartBeat(t *testing.T) {
+	srv := NewServer(1)
+	srv.SetHeartBeat(20 * time.Millisecond)
+	c := testConnect(t, srv, "0,20")
+
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	b, err := c.r.ReadByte()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b != '\n' {
+		t.Fatalf("expected heart-beat, received %q", b)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	c := testDial(t, NewServer(1))
+	c.write(t, "CONNECT", "accept-version:1.0,1.1", "host:localhost")
+	if f := c.read(t); f.Command != "ERROR" || f.Get("version") != "1.2" {
+		t.Fatal("expected version ERROR frame, received", f.Command)
+	}
+}
+
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func testDial(t *testing.T, srv *Server) *testClient {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { l.Close() })
+	go srv.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+func testConnect(t *testing.T, srv *Server, hb string) *testClient {
+	c := testDial(t, srv)
+	c.write(t, "CONNECT", "accept-version:1.2", "host:localhost", "heart-beat:"+hb)
+	if f := c.read(t); f.Command != "CONNECTED" {
+		t.Fatal("expected CONNECTED frame, received", f.Command, f.Get("message"))
+	}
+
+	return c
+}
+
+// write will write a frame, lines after an empty line make up the body
+func (c *testClient) write(t *testing.T, command string, lines ...string) {
+	f := Frame{Command: command}
+	for i, line := range lines {
+		if line == "" {
+			f.Body = []byte(lines[i+1])
+			break
+		}
+
+		for j := 0; j < len(line); j++ {
+			if line[j] == ':' {
+				f.Set(line[:j], line[j+1:])
+				break
+			}
+		}
+	}
+
+	if err := writeFrame(c.w, &f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (c *testClient) read(t *testing.T) Frame {
+	c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	f, err := readFrame(c.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
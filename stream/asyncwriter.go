@@ -0,0 +1,194 @@
+// Package stream provides byte streams over []byte mailboxes: an AsyncWriter which
+// moves writes off the calling goroutine, and in-memory pipes and connections whose
+// writes only block once their buffer is full.
+//
+// Pipe and ConnPair live here rather than in the mailbox package itself: the sources
+// of the mailbox package are templates generated into every typed package (See
+// typed), where a pipe of []byte chunks would not compile for other element types.
+package stream
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	mailbox "github.com/itsmontoya/mailbox/typed/s_byte"
+)
+
+const (
+	// DefaultCoalesce is the default number of bytes an AsyncWriter coalesces into a single write
+	DefaultCoalesce = 64 * 1024
+	// maxPooled is the capacity above which buffers are not returned to the pool
+	maxPooled = 64 * 1024
+)
+
+// ErrClosed is returned when writing to a closed AsyncWriter
+var ErrClosed = errors.New("stream: writer is closed")
+
+// NewAsyncWriter returns an AsyncWriter which queues up to sz writes for w
+func NewAsyncWriter(w io.Writer, sz int) *AsyncWriter {
+	var a AsyncWriter
+	a.w = w
+	a.coalesce = DefaultCoalesce
+	a.done = make(chan struct{})
+	a.cond = sync.NewCond(&a.mux)
+	// Count sends under the mailbox lock, so that the count matches the queue order
+	a.mb = mailbox.NewWithOptions(sz, mailbox.Options{
+		Hooks: mailbox.Hooks{
+			OnSend: func([]byte) { a.queued.Add(1) },
+		},
+	})
+
+	go a.run()
+	return &a
+}
+
+// AsyncWriter is an io.Writer which hands writes to an underlying writer on a
+// background goroutine, so that callers never block on I/O unless the queue is full.
+//
+// Each Write is copied into a pooled buffer and queued. Queued writes are coalesced
+// into writes of up to SetCoalesce bytes. An error returned by the underlying writer
+// is sticky, it is returned by the next (and every following) Write, Flush and Close.
+type AsyncWriter struct {
+	w  io.Writer
+	mb *mailbox.Mailbox
+
+	pool     sync.Pool
+	coalesce int
+
+	// queued is the number of writes sent to the mailbox
+	queued atomic.Uint64
+	// done is closed once the mailbox has been closed and drained
+	done chan struct{}
+
+	mux  sync.Mutex
+	cond *sync.Cond
+	// written is the number of queued writes handed to w
+	written uint64
+	err     error
+}
+
+// SetCoalesce will set the number of bytes queued writes are coalesced into, a value
+// of 1 or less disables coalescing
+// Note: Must be called before the first Write
+func (a *AsyncWriter) SetCoalesce(n int) {
+	a.coalesce = n
+}
+
+// Write will queue a copy of p, waiting for room when the queue is full
+func (a *AsyncWriter) Write(p []byte) (n int, err error) {
+	if err = a.Err(); err != nil {
+		return
+	}
+
+	if len(p) == 0 {
+		return
+	}
+
+	buf := append(a.get(len(p)), p...)
+	if a.mb.Send(buf, true) != mailbox.StateOK {
+		a.put(buf)
+		return 0, ErrClosed
+	}
+
+	return len(p), nil
+}
+
+// Flush will wait until every write queued before the call has been handed to the
+// underlying writer, the sticky error is returned
+func (a *AsyncWriter) Flush() (err error) {
+	target := a.queued.Load()
+	a.mux.Lock()
+	for a.written < target && a.err == nil {
+		a.cond.Wait()
+	}
+
+	err = a.err
+	a.mux.Unlock()
+	return
+}
+
+// Close will stop accepting writes and wait until every queued write has been
+// handed to the underlying writer, the sticky error is returned
+// Note: The underlying writer is not closed
+func (a *AsyncWriter) Close() error {
+	a.mb.Close()
+	<-a.done
+	return a.Err()
+}
+
+// Err will return the sticky error of the underlying writer, if any
+func (a *AsyncWriter) Err() (err error) {
+	a.mux.Lock()
+	err = a.err
+	a.mux.Unlock()
+	return
+}
+
+func (a *AsyncWriter) run() {
+	var out []byte
+	for {
+		msg, state := a.mb.Receive(true)
+		if state != mailbox.StateOK {
+			// Our mailbox is empty and closed
+			break
+		}
+
+		n := 1
+		out = append(out[:0], msg...)
+		a.put(msg)
+		// Coalesce the writes which are already queued
+		for len(out) < a.coalesce {
+			if msg, state = a.mb.Receive(false); state != mailbox.StateOK {
+				break
+			}
+
+			out = append(out, msg...)
+			a.put(msg)
+			n++
+		}
+
+		a.write(out, n)
+	}
+
+	close(a.done)
+}
+
+// write will hand the provided bytes, made up of n queued writes, to the underlying writer
+func (a *AsyncWriter) write(b []byte, n int) {
+	var err error
+	if a.Err() == nil {
+		// Once we have failed, queued writes are discarded
+		_, err = a.w.Write(b)
+	}
+
+	a.mux.Lock()
+	if err != nil && a.err == nil {
+		a.err = err
+	}
+
+	a.written += uint64(n)
+	a.cond.Broadcast()
+	a.mux.Unlock()
+}
+
+// get will return an empty buffer with room for at least n bytes
+func (a *AsyncWriter) get(n int) []byte {
+	if bp, ok := a.pool.Get().(*[]byte); ok && cap(*bp) >= n {
+		return (*bp)[:0]
+	}
+
+	return make([]byte, 0, max(n, 512))
+}
+
+// put will return the provided buffer to the pool
+func (a *AsyncWriter) put(b []byte) {
+	if cap(b) > maxPooled {
+		// Let oversized buffers be collected
+		return
+	}
+
+	b = b[:0]
+	a.pool.Put(&b)
+}
@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// testWriter records every write it receives, blocking while held
+type testWriter struct {
+	mux    sync.Mutex
+	hold   sync.Mutex
+	buf    bytes.Buffer
+	writes int
+	err    error
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.hold.Lock()
+	defer w.hold.Unlock()
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.writes++
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	return w.buf.Write(p)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	var w testWriter
+	a := NewAsyncWriter(&w, 16)
+	p := []byte("hello ")
+	a.Write(p)
+	// Our write was copied, the caller may reuse its buffer
+	copy(p, "xxxxxx")
+	a.Write([]byte("world"))
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.buf.String() != "hello world" {
+		t.Fatal("invalid output", w.buf.String())
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Write(p); err != ErrClosed {
+		t.Fatal("expected ErrClosed", err)
+	}
+}
+
+func TestAsyncWriterCoalesce(t *testing.T) {
+	var w testWriter
+	a := NewAsyncWriter(&w, 16)
+	// Hold the underlying writer so that writes queue up behind the first
+	w.hold.Lock()
+	for i := 0; i < 10; i++ {
+		a.Write([]byte{'a' + byte(i)})
+	}
+
+	w.hold.Unlock()
+	a.Close()
+	if w.buf.String() != "abcdefghij" {
+		t.Fatal("invalid output", w.buf.String())
+	}
+
+	if w.writes >= 10 {
+		t.Fatal("expected queued writes to be coalesced", w.writes)
+	}
+}
+
+func TestAsyncWriterError(t *testing.T) {
+	w := testWriter{err: errors.New("disk full")}
+	a := NewAsyncWriter(&w, 16)
+	a.Write([]byte("a"))
+	if err := a.Flush(); err != w.err {
+		t.Fatal("expected error from Flush", err)
+	}
+
+	// The error is reported on the next write
+	if _, err := a.Write([]byte("b")); err != w.err {
+		t.Fatal("expected error from Write", err)
+	}
+
+	if err := a.Close(); err != w.err {
+		t.Fatal("expected error from Close", err)
+	}
+}
@@ -0,0 +1,376 @@
+package stream
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	mailbox "github.com/itsmontoya/mailbox/typed/s_byte"
+)
+
+const (
+	// DefaultConnSize is the number of chunks buffered in each direction of a ConnPair
+	DefaultConnSize = 64
+	// maxChunk is the largest chunk a single write is split into
+	maxChunk = 32 * 1024
+)
+
+// Pipe creates a buffered in-memory pipe, it behaves like io.Pipe except that
+// up to sz chunks are buffered: a write only blocks once the buffer is full.
+// Each write is copied into chunks of up to 32KiB, so the caller may reuse its
+// buffer once the write returns.
+//
+// Reads and writes are safe to call in parallel, individual calls are gated
+// sequentially. Data buffered when the writer is closed is still read before
+// the reader observes io.EOF (or the error the writer was closed with).
+func Pipe(sz int) (*PipeReader, *PipeWriter) {
+	p := newPipe(sz)
+	return &PipeReader{p: p}, &PipeWriter{p: p}
+}
+
+// PipeReader is the read half of a pipe
+type PipeReader struct {
+	p *pipe
+}
+
+// Read will read data from the pipe, blocking until data is available or the write half is closed
+func (r *PipeReader) Read(b []byte) (n int, err error) {
+	return r.p.read(b)
+}
+
+// Close will close the reader, subsequent writes to the write half of the pipe
+// will return io.ErrClosedPipe
+func (r *PipeReader) Close() error {
+	return r.CloseWithError(nil)
+}
+
+// CloseWithError will close the reader, subsequent writes to the write half of the
+// pipe will return err, or io.ErrClosedPipe when err is nil
+func (r *PipeReader) CloseWithError(err error) error {
+	r.p.closeRead(err)
+	return nil
+}
+
+// PipeWriter is the write half of a pipe
+type PipeWriter struct {
+	p *pipe
+}
+
+// Write will write data to the pipe, blocking while the buffer is full
+func (w *PipeWriter) Write(b []byte) (n int, err error) {
+	return w.p.write(b)
+}
+
+// Close will close the writer, once buffered data is read subsequent reads from
+// the read half of the pipe will return io.EOF
+func (w *PipeWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseWithError will close the writer, once buffered data is read subsequent reads
+// from the read half of the pipe will return err, or io.EOF when err is nil
+func (w *PipeWriter) CloseWithError(err error) error {
+	w.p.closeWrite(err)
+	return nil
+}
+
+// ConnPair returns both ends of a buffered, in-memory, full duplex connection.
+// Data written to one end is read from the other, through a mailbox of up to
+// DefaultConnSize chunks per direction. Unlike net.Pipe, writes only block once
+// the buffer of their direction is full.
+//
+// Deadlines are supported, an operation which exceeds its deadline returns an
+// error wrapping os.ErrDeadlineExceeded (a net.Error whose Timeout is true).
+func ConnPair() (net.Conn, net.Conn) {
+	a := newPipe(DefaultConnSize)
+	b := newPipe(DefaultConnSize)
+	return &conn{r: a, w: b}, &conn{r: b, w: a}
+}
+
+func newPipe(sz int) *pipe {
+	return &pipe{
+		mb:      mailbox.New(sz),
+		changed: make(chan struct{}),
+	}
+}
+
+// pipe is a single direction of data through a mailbox of chunks
+type pipe struct {
+	mb *mailbox.Mailbox
+
+	// rmux gates reads, buf is the unread remainder of the current chunk
+	rmux sync.Mutex
+	buf  []byte
+
+	// wmux gates writes
+	wmux sync.Mutex
+
+	mux sync.Mutex
+	// rerr and werr are the errors the read and write halves were closed with
+	rerr error
+	werr error
+	// rclosed and wclosed are whether or not the read and write halves are closed
+	rclosed bool
+	wclosed bool
+	// rdeadline and wdeadline are the read and write deadlines, zero for none
+	rdeadline time.Time
+	wdeadline time.Time
+	// changed is closed (and replaced) whenever a deadline changes, waking any waiters
+	changed chan struct{}
+}
+
+func (p *pipe) read(b []byte) (n int, err error) {
+	p.rmux.Lock()
+	defer p.rmux.Unlock()
+	for len(p.buf) == 0 {
+		if err = p.readable(); err != nil {
+			return
+		}
+
+		msg, state := p.mb.Receive(false)
+		switch state {
+		case mailbox.StateOK:
+			p.buf = msg
+		case mailbox.StateEmpty:
+			err = p.wait(p.mb.ReadyToReceive(), true)
+		case mailbox.StateClosed:
+			err = p.eof()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	n = copy(b, p.buf)
+	p.buf = p.buf[n:]
+	return
+}
+
+func (p *pipe) write(b []byte) (n int, err error) {
+	p.wmux.Lock()
+	defer p.wmux.Unlock()
+	if len(b) == 0 {
+		// Nothing to write, a closed pipe still reports its error as io.Pipe does
+		return 0, p.writable()
+	}
+
+	for len(b) > 0 {
+		if err = p.writable(); err != nil {
+			return
+		}
+
+		sz := min(len(b), maxChunk)
+		chunk := make([]byte, sz)
+		copy(chunk, b)
+		if err = p.send(chunk); err != nil {
+			return
+		}
+
+		n += sz
+		b = b[sz:]
+	}
+
+	return
+}
+
+// send will send the provided chunk, waiting for room until the write deadline
+func (p *pipe) send(chunk []byte) (err error) {
+	for {
+		switch p.mb.Send(chunk, false) {
+		case mailbox.StateOK:
+			return
+		case mailbox.StateClosed:
+			// Either half was closed, writable returns the matching error
+			return p.writable()
+		}
+
+		// Our mailbox is full, wait for room
+		if err = p.wait(p.mb.ReadyToSend(), false); err != nil {
+			return
+		}
+	}
+}
+
+// readable will return the error of a read, if it cannot proceed
+func (p *pipe) readable() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	switch {
+	case p.rclosed:
+		return io.ErrClosedPipe
+	case !p.rdeadline.IsZero() && !time.Now().Before(p.rdeadline):
+		return os.ErrDeadlineExceeded
+	}
+
+	return nil
+}
+
+// writable will return the error of a write, if it cannot proceed
+func (p *pipe) writable() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	switch {
+	case p.wclosed:
+		return io.ErrClosedPipe
+	case p.rclosed:
+		if p.rerr != nil {
+			return p.rerr
+		}
+
+		return io.ErrClosedPipe
+	case !p.wdeadline.IsZero() && !time.Now().Before(p.wdeadline):
+		return os.ErrDeadlineExceeded
+	}
+
+	return nil
+}
+
+// eof will return the error of a read once the pipe is drained
+func (p *pipe) eof() error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	switch {
+	case p.rclosed:
+		return io.ErrClosedPipe
+	case p.werr != nil:
+		return p.werr
+	}
+
+	return io.EOF
+}
+
+// wait will wait for the provided readiness channel, a deadline change, or the
+// read (or write) deadline, whichever comes first
+func (p *pipe) wait(ready <-chan struct{}, read bool) error {
+	var timeout <-chan time.Time
+	p.mux.Lock()
+	deadline, changed := p.wdeadline, p.changed
+	if read {
+		deadline = p.rdeadline
+	}
+
+	p.mux.Unlock()
+	if !deadline.IsZero() {
+		t := time.NewTimer(time.Until(deadline))
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	select {
+	case <-ready:
+	case <-changed:
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	}
+
+	return nil
+}
+
+func (p *pipe) closeRead(err error) {
+	p.mux.Lock()
+	if !p.rclosed {
+		p.rclosed, p.rerr = true, err
+	}
+
+	p.mux.Unlock()
+	// Closing our mailbox wakes any blocked writers
+	p.mb.Close()
+}
+
+func (p *pipe) closeWrite(err error) {
+	p.mux.Lock()
+	if !p.wclosed {
+		p.wclosed, p.werr = true, err
+	}
+
+	p.mux.Unlock()
+	// Closing our mailbox lets the reader drain and then observe the close
+	p.mb.Close()
+}
+
+func (p *pipe) setDeadline(t time.Time, read, write bool) {
+	p.mux.Lock()
+	if read {
+		p.rdeadline = t
+	}
+
+	if write {
+		p.wdeadline = t
+	}
+
+	// Wake our waiters so that they observe the new deadline
+	close(p.changed)
+	p.changed = make(chan struct{})
+	p.mux.Unlock()
+}
+
+// conn is one end of a ConnPair, it reads from r and writes to w
+type conn struct {
+	r *pipe
+	w *pipe
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	n, err := c.r.read(b)
+	return n, c.wrap("read", err)
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	n, err := c.w.write(b)
+	return n, c.wrap("write", err)
+}
+
+// Close will close both directions, the other end reads io.EOF once it has read
+// any buffered data and its writes fail
+func (c *conn) Close() error {
+	c.r.closeRead(nil)
+	c.w.closeWrite(nil)
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return connAddr{}
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return connAddr{}
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.r.setDeadline(t, true, false)
+	c.w.setDeadline(t, false, true)
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t, true, false)
+	return nil
+}
+
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.w.setDeadline(t, false, true)
+	return nil
+}
+
+// wrap will wrap errors other than io.EOF in a *net.OpError, as a net.Conn would
+func (c *conn) wrap(op string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+
+	return &net.OpError{Op: op, Net: connAddr{}.Network(), Source: c.LocalAddr(), Addr: c.RemoteAddr(), Err: err}
+}
+
+// connAddr is the address of both ends of a ConnPair
+type connAddr struct{}
+
+func (connAddr) Network() string {
+	return "mailbox"
+}
+
+func (connAddr) String() string {
+	return "mailbox"
+}
@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	r, w := Pipe(4)
+	// Writes do not block until the buffer is full
+	w.Write([]byte("hello "))
+	w.Write([]byte("world"))
+	w.Close()
+
+	b, err := io.ReadAll(r)
+	if err != nil || string(b) != "hello world" {
+		t.Fatal("invalid read", string(b), err)
+	}
+}
+
+func TestPipeLarge(t *testing.T) {
+	r, w := Pipe(2)
+	src := bytes.Repeat([]byte("0123456789"), 100000)
+	go func() {
+		w.Write(src)
+		w.CloseWithError(errors.New("done"))
+	}()
+
+	var dst bytes.Buffer
+	if _, err := io.Copy(&dst, r); err == nil || err.Error() != "done" {
+		t.Fatal("expected the error the writer was closed with", err)
+	}
+
+	if !bytes.Equal(dst.Bytes(), src) {
+		t.Fatal("invalid data read", dst.Len())
+	}
+}
+
+func TestPipeCloseReader(t *testing.T) {
+	r, w := Pipe(1)
+	w.Write([]byte("a"))
+	errc := make(chan error)
+	go func() {
+		// Our buffer is full, this write blocks until the reader is closed
+		_, err := w.Write([]byte("b"))
+		errc <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	r.Close()
+	if err := <-errc; err != io.ErrClosedPipe {
+		t.Fatal("expected io.ErrClosedPipe", err)
+	}
+
+	// An empty write fails too once the pipe is closed
+	for _, b := range [][]byte{nil, {}} {
+		if n, err := w.Write(b); n != 0 || err != io.ErrClosedPipe {
+			t.Fatal("expected io.ErrClosedPipe", n, err)
+		}
+	}
+}
+
+func TestConnPair(t *testing.T) {
+	a, b := ConnPair()
+	defer a.Close()
+	defer b.Close()
+
+	a.Write([]byte("ping"))
+	buf := make([]byte, 8)
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "ping" {
+		t.Fatal("invalid read", string(buf[:n]), err)
+	}
+
+	b.Write([]byte("pong"))
+	if n, err := a.Read(buf); err != nil || string(buf[:n]) != "pong" {
+		t.Fatal("invalid read", string(buf[:n]), err)
+	}
+}
+
+func TestConnPairDeadline(t *testing.T) {
+	a, b := ConnPair()
+	a.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := a.Read(make([]byte, 1))
+	var nerr net.Error
+	if !errors.As(err, &nerr) || !nerr.Timeout() || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("expected timeout", err)
+	}
+
+	// Clearing the deadline of a blocked read lets it wait past the old deadline
+	errc := make(chan error)
+	a.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	go func() {
+		_, err := a.Read(make([]byte, 1))
+		errc <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	a.SetReadDeadline(time.Time{})
+	time.Sleep(60 * time.Millisecond)
+	b.Write([]byte("x"))
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the buffer of b, the next write times out
+	for i := 0; i < DefaultConnSize; i++ {
+		b.Write([]byte("x"))
+	}
+
+	b.SetWriteDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := b.Write([]byte("x")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("expected timeout", err)
+	}
+
+	b.Close()
+	if _, err := a.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatal("expected io.ErrClosedPipe", err)
+	}
+}
@@ -0,0 +1,76 @@
+package mailbox
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+
+	"github.com/joeshaw/gengen/generic"
+)
+
+const (
+	// sendWait is the trace region and goroutine label of senders blocked on a full mailbox
+	sendWait = "mailbox.sendWait"
+	// recvWait is the trace region and goroutine label of receivers blocked on an empty mailbox
+	recvWait = "mailbox.recvWait"
+)
+
+// SendCtx will send a message in the same manner as Send. While blocked waiting for
+// a vacant entry, the goroutine carries the labels of ctx along with the label
+// mailbox=mailbox.sendWait, so that goroutine and CPU profiles show where senders wait.
+// Unlike Send, the goroutine keeps the labels of ctx once the wait is over.
+// Note: ctx does not cancel the send. When send interceptors are installed, the
+// send goes through them and ctx is not used
+func (m *Mailbox) SendCtx(ctx context.Context, msg generic.T, wait bool) (state StateCode) {
+	if m.sendFn != nil {
+		return m.sendFn(msg, wait)
+	}
+
+	m.mux.Lock()
+	if m.isClosed() {
+		state = StateClosed
+		goto END
+	}
+
+	state = m.sendCtx(ctx, msg, wait)
+
+END:
+	m.mux.Unlock()
+	return
+}
+
+// ReceiveCtx will receive a message in the same manner as Receive. While blocked
+// waiting for a message, the goroutine carries the labels of ctx along with the
+// label mailbox=mailbox.recvWait. Unlike Receive, the goroutine keeps the labels of
+// ctx once the wait is over.
+// Note: ctx does not cancel the receive. When receive interceptors are installed,
+// the receive goes through them and ctx is not used
+func (m *Mailbox) ReceiveCtx(ctx context.Context, wait bool) (msg generic.T, state StateCode) {
+	if m.receiveFn != nil {
+		return m.receiveFn(wait)
+	}
+
+	m.mux.Lock()
+	msg, _, state = m.receiveCtx(ctx, wait)
+	m.mux.Unlock()
+	return
+}
+
+// block will wait on the provided cond within a runtime/trace region of the provided
+// name, so that `go tool trace` shows the time spent blocked. The goroutine is labeled
+// mailbox=name for the duration of the wait and its labels are restored to those of
+// ctx afterwards. When ctx is nil (Send, Receive and friends) the labels of the caller
+// are unknown, they are cleared after the wait, SendCtx and ReceiveCtx keep them
+// Note: Lock is expected to be held when calling
+func (m *Mailbox) block(ctx context.Context, c Cond, name string) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	region := trace.StartRegion(ctx, name)
+	pprof.Do(ctx, pprof.Labels("mailbox", name), func(context.Context) {
+		c.Wait()
+	})
+
+	region.End()
+}
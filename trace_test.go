@@ -0,0 +1,82 @@
+package mailbox
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceRegions(t *testing.T) {
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skip("tracing is unavailable", err)
+	}
+
+	mb := New(1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mb.Send(1, true)
+		mb.Send(2, true)
+	}()
+
+	mb.Receive(true)
+	time.Sleep(10 * time.Millisecond)
+	mb.Receive(true)
+	trace.Stop()
+
+	if !bytes.Contains(buf.Bytes(), []byte(recvWait)) {
+		t.Fatal("expected trace to contain the receive wait region")
+	}
+}
+
+func TestReceiveCtxLabels(t *testing.T) {
+	mb := New(1)
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("worker", "a"))
+	done := make(chan struct{})
+	go func() {
+		pprof.SetGoroutineLabels(ctx)
+		mb.ReceiveCtx(ctx, true)
+		close(done)
+	}()
+
+	// Wait for our receiver to block
+	for mb.Stats().BlockedReceivers == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	if !strings.Contains(buf.String(), `"mailbox":"mailbox.recvWait"`) || !strings.Contains(buf.String(), `"worker":"a"`) {
+		t.Fatal("expected blocked receiver to be labeled\n", buf.String())
+	}
+
+	mb.Send(1, false)
+	<-done
+}
+
+func TestReceiveLabels(t *testing.T) {
+	mb := New(1)
+	done := make(chan struct{})
+	go func() {
+		mb.Receive(true)
+		close(done)
+	}()
+
+	// Wait for our receiver to block
+	for mb.Stats().BlockedReceivers == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	if !strings.Contains(buf.String(), `"mailbox":"mailbox.recvWait"`) {
+		t.Fatal("expected blocked receiver to be labeled\n", buf.String())
+	}
+
+	mb.Send(1, false)
+	<-done
+}
@@ -0,0 +1,28 @@
+package mailbox
+
+// Hooks are lifecycle callbacks of a mailbox, any nil hook is skipped.
+//
+// OnSend, OnReceive, OnDrop, OnFull and OnEmpty run synchronously while the mailbox
+// lock is held, in the order the events happen. They must be quick and must not call
+// into the mailbox, doing so will deadlock. Hand work off to another goroutine (or
+// another mailbox) when it is anything more than a counter or a non-blocking log.
+//
+// OnClose runs asynchronously on its own goroutine once Close has notified all
+// waiters, it is free to call into the mailbox (e.g. to drain it).
+type Hooks struct {
+	// OnSend is called after a message has been added to the mailbox
+	OnSend func(msg byte)
+	// OnReceive is called after a message has been removed from the mailbox by a receiver
+	OnReceive func(msg byte)
+	// OnDrop is called before a message is discarded without being received. Sends never
+	// overwrite messages, so only controlled delay drops them (See CoDel)
+	OnDrop func(msg byte)
+	// OnFull is called each time a send (or atomic batch) finds the mailbox without
+	// room, before it waits or returns StateFull
+	OnFull func()
+	// OnEmpty is called each time a receive finds the mailbox empty (and not closed),
+	// before it waits or returns StateEmpty
+	OnEmpty func()
+	// OnClose is called once, when the mailbox is closed
+	OnClose func()
+}
@@ -1,48 +1,115 @@
 package mailbox
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // New returns a new instance of Mailbox
 func New(sz int) *Mailbox {
+	return NewWithOptions(sz, Options{})
+}
+
+// NewWithOptions returns a new instance of Mailbox with the provided options
+func NewWithOptions(sz int, opts Options) *Mailbox {
 	mb := Mailbox{
 		cap:  sz,
 		tail: -1,
 
-		s: make([]byte, sz),
+		s:    make([]byte, sz),
+		done: make(chan struct{}),
+
+		clock: opts.Clock,
+		hooks: opts.Hooks,
+
+		sendInterceptors:    opts.SendInterceptors,
+		receiveInterceptors: opts.ReceiveInterceptors,
+	}
+
+	if len(mb.sendInterceptors) > 0 {
+		mb.sendFn = mb.countShed(mb.chainSend(mb.sendDirect))
+	}
+
+	if len(mb.receiveInterceptors) > 0 {
+		mb.receiveFn = mb.chainReceive(mb.receiveDirect)
+	}
+
+	if opts.CoDel != nil {
+		mb.codel = newCodel(*opts.CoDel)
+		// Controlled delay relies on the sojourn time of every message
+		opts.TrackSojourn = true
+	}
+
+	if mb.clock == nil {
+		mb.clock = time.Now
+	}
+
+	if opts.TrackSojourn {
+		// Every slot records the time its message was sent
+		mb.ts = make([]time.Time, sz)
+		mb.sojourn = &Histogram{}
+	}
+
+	sched := opts.Scheduler
+	if sched == nil {
+		sched = syncScheduler{}
 	}
 
 	// Initialize the conds
-	mb.sc = sync.NewCond(&mb.mux)
-	mb.rc = sync.NewCond(&mb.mux)
+	mb.sc = sched.NewCond(&mb.mux)
+	mb.rc = sched.NewCond(&mb.mux)
 	return &mb
 }
 
-// MailboxIface defines the behaviour of a mailbox, it can be implemented
-// with a different type of elements.
-type MailboxIface interface {
-	Send(msg byte)
-	Batch(msgs ...byte)
-	Receive() (msg byte, state StateCode)
-	Listen(fn func(msg byte) (end bool)) (state StateCode)
-	Close()
-}
-
 // Mailbox is used to send and receive messages
 type Mailbox struct {
 	mux sync.Mutex
-	sc  *sync.Cond
-	rc  *sync.Cond
+	sc  Cond
+	rc  Cond
 
 	s []byte
+	// ts are the send times of the messages in s, only set when tracking sojourn times
+	ts []time.Time
+	// sel are the channels of selectors waiting on this mailbox (see Select)
+	sel []chan struct{}
+	// rr and rs are the readiness channels (see ReadyToReceive and ReadyToSend)
+	rr chan struct{}
+	rs chan struct{}
+	// done is closed when the mailbox is closed
+	done chan struct{}
 
 	len  int
 	cap  int
 	head int
 	tail int
 
+	// aw is the number of atomic batches waiting for room
+	aw int
+	// sw and rw are the number of blocked senders and receivers
+	sw int
+	rw int
+
+	// Counters, see Stats
+	sent     uint64
+	received uint64
+	dropped  uint64
+	shed     uint64
+	maxLen   int
+	sojourn  *Histogram
+
+	clock func() time.Time
+	// codel is the controlled delay state, only set when load shedding is enabled
+	codel *codel
+	hooks Hooks
+
+	sendInterceptors    []SendInterceptor
+	receiveInterceptors []ReceiveInterceptor
+	// sendFn and receiveFn are the interceptor chains, only set when interceptors are installed
+	sendFn    SendFunc
+	receiveFn ReceiveFunc
+
 	closed int32
 }
 
@@ -50,37 +117,80 @@ func (m *Mailbox) isClosed() bool {
 	return atomic.LoadInt32(&m.closed) == 1
 }
 
-// rWait is a wait function for receivers
-func (m *Mailbox) rWait() (ok bool) {
-START:
-	if m.len > 0 {
-		// We have at least one unread message, return true
-		return true
-	}
+// rWait is a wait function for receivers, ctx is used to label the wait and may be nil
+func (m *Mailbox) rWait(ctx context.Context, wait bool) (state StateCode) {
+	for m.len == 0 {
+		if m.isClosed() {
+			// Our inbox is empty AND closed, return StateClosed
+			return StateClosed
+		}
 
-	if m.isClosed() {
-		// We have an empty inbox AND we are closed, done bro - done.
-		return false
+		if !wait {
+			// We aren't waiting for new messages, return StateEmpty
+			return StateEmpty
+		}
+
+		// Let's wait for a signal..
+		m.rw++
+		m.block(ctx, m.rc, recvWait)
+		m.rw--
 	}
 
-	// Let's wait for a signal..
-	m.rc.Wait()
-	// Signal received, let's check again!
-	goto START
+	// We waited for an available message, return StateOK
+	return
 }
 
 var empty byte
 
 // receive is the internal function for receiving messages
-func (m *Mailbox) receive() (msg byte, state StateCode) {
-	if !m.rWait() {
-		// Ok was returned as false, set state to closed and return
-		state = StateClosed
+func (m *Mailbox) receive(wait bool) (msg byte, state StateCode) {
+	msg, _, state = m.receiveAge(wait)
+	return
+}
+
+// receiveAge is the internal function for receiving messages along with the time
+// they spent in the mailbox, age is zero when sojourn times are not tracked
+func (m *Mailbox) receiveAge(wait bool) (msg byte, age time.Duration, state StateCode) {
+	return m.receiveCtx(nil, wait)
+}
+
+// receiveCtx is the internal function for receiving messages with a context, ctx is
+// used to label the wait and may be nil (See receiveAge)
+func (m *Mailbox) receiveCtx(ctx context.Context, wait bool) (msg byte, age time.Duration, state StateCode) {
+	if m.len == 0 && m.hooks.OnEmpty != nil && !m.isClosed() {
+		// Let our hook know that a receive found the mailbox empty
+		m.hooks.OnEmpty()
+	}
+
+	if state = m.rWait(ctx, wait); state != StateOK {
 		return
 	}
 
+	if m.ts != nil {
+		now := m.clock()
+		age = now.Sub(m.ts[m.head])
+		if m.codel != nil {
+			// Controlled delay may discard messages at the head, age becomes that of the new head
+			age = m.codelDequeue(now, age)
+		}
+
+		// Record the time our message spent in the mailbox
+		m.sojourn.Record(age)
+	}
+
 	// Set message as the current head
 	msg = m.s[m.head]
+	m.received++
+	m.remove()
+	if m.hooks.OnReceive != nil {
+		m.hooks.OnReceive(msg)
+	}
+
+	return
+}
+
+// remove will remove the message at the head
+func (m *Mailbox) remove() {
 	// Empty the current head value to avoid any retainment issues
 	m.s[m.head] = empty
 	// Goto the next index
@@ -90,73 +200,267 @@ func (m *Mailbox) receive() (msg byte, state StateCode) {
 	}
 
 	// Decrement the length
-	if m.len--; m.len == m.cap-1 {
+	if m.len--; m.len == m.cap-1 || m.aw > 0 {
 		// Notify the senders that we have a vacant entry
 		m.sc.Broadcast()
+		m.notifySelectors()
+		signal(m.rs)
+	}
+}
+
+// sWait is a wait function for senders, ctx is used to label the wait and may be nil
+func (m *Mailbox) sWait(ctx context.Context, wait bool) (state StateCode) {
+	for m.cap-m.len == 0 {
+		if m.isClosed() {
+			// Our inbox was closed while we were waiting, return StateClosed
+			return StateClosed
+		}
+
+		if !wait {
+			return StateFull
+		}
+
+		// There are no vacant spots in the inbox, time to wait
+		m.sw++
+		m.block(ctx, m.sc, sendWait)
+		m.sw--
+	}
+
+	if m.isClosed() {
+		// Our inbox was closed before a receive made room for us, return StateClosed
+		return StateClosed
 	}
 
+	// An entry is available, return StateOK
 	return
 }
 
-// send is the internal function used for sending messages
-func (m *Mailbox) send(msg byte) {
-CHECKFREE:
-	if m.cap-m.len == 0 {
-		// There are no vacant spots in the inbox, time to wait
-		m.sc.Wait()
-		// We received a signal, check again!
-		goto CHECKFREE
+// send is the internal function used for sending messages, if the list is full:
+//  - If wait is true, will wait for an available space
+//  - Else, will return will early with a state of StateFull
+func (m *Mailbox) send(msg byte, wait bool) (state StateCode) {
+	return m.sendCtx(nil, msg, wait)
+}
+
+// sendCtx is the internal function used for sending messages with a context, ctx is
+// used to label the wait and may be nil (See send)
+func (m *Mailbox) sendCtx(ctx context.Context, msg byte, wait bool) (state StateCode) {
+	if m.codel != nil && m.codelShed() {
+		// Controlled delay is rejecting sends until latency recovers
+		return StateShed
+	}
+
+	if m.len == m.cap && m.hooks.OnFull != nil {
+		// Let our hook know that a send found the mailbox full
+		m.hooks.OnFull()
+	}
+
+	if state = m.sWait(ctx, wait); state != StateOK {
+		return
+	}
+
+	m.write(msg)
+	return
+}
+
+// pop will append a new message to the end of the list
+// If the list is full, the oldest message will be overwritten
+// Note: No send overwrites messages, pop is not reachable from the public API
+func (m *Mailbox) pop(msg byte) {
+	if m.len == m.cap {
+		if m.hooks.OnDrop != nil {
+			m.hooks.OnDrop(m.s[m.head])
+		}
+
+		// Our tail is about to overwrite the head, move the head past the oldest message
+		if m.head++; m.head == m.cap {
+			m.head = 0
+		}
+
+		m.len--
+		m.dropped++
+	}
+
+	m.write(msg)
+}
+
+// write will write the provided message to the tail
+// Note: Room is expected to be available when calling
+func (m *Mailbox) write(msg byte) {
+	// Increment tail index
+	m.incTail()
+	// Send the new tail as the provided message
+	m.s[m.tail] = msg
+	m.stamp()
+	// Increment the length
+	m.incLen()
+	if m.hooks.OnSend != nil {
+		m.hooks.OnSend(msg)
 	}
+}
 
+// stamp will record the send time of the message at the tail
+func (m *Mailbox) stamp() {
+	if m.ts != nil {
+		m.ts[m.tail] = m.clock()
+	}
+}
+
+func (m *Mailbox) incTail() {
 	// Goto the next index
 	if m.tail++; m.tail == m.cap {
 		// Our increment falls out of the bounds of our internal slice, reset to 0
 		m.tail = 0
 	}
+}
 
-	// Send the new tail as the provided message
-	m.s[m.tail] = msg
-
+func (m *Mailbox) incLen() {
+	m.sent++
 	// Increment the length
 	if m.len++; m.len == 1 {
 		// Notify the receivers that we new message
 		m.rc.Broadcast()
+		m.notifySelectors()
+		signal(m.rr)
 	}
+
+	if m.len > m.maxLen {
+		m.maxLen = m.len
+	}
+}
+
+// Send will send a message and return its state (See the "State" constants for more
+// information): StateFull when the mailbox is full and wait is false, StateClosed
+// when the mailbox is closed, including once a send waiting for room is woken by Close
+func (m *Mailbox) Send(msg byte, wait bool) (state StateCode) {
+	if m.sendFn != nil {
+		// Route our message through the send interceptors
+		return m.sendFn(msg, wait)
+	}
+
+	return m.sendDirect(msg, wait)
 }
 
-// Send will send a message
-func (m *Mailbox) Send(msg byte) {
+// sendDirect will send a message without going through the send interceptors
+func (m *Mailbox) sendDirect(msg byte, wait bool) (state StateCode) {
 	m.mux.Lock()
 	if m.isClosed() {
+		state = StateClosed
 		goto END
 	}
 
-	m.send(msg)
+	state = m.send(msg, wait)
 
 END:
 	m.mux.Unlock()
+	return
 }
 
-// Batch will send a batch of messages
+// Batch will send a batch of messages, waiting for room as needed
+// Note: See BatchN to find out how many messages were sent
 func (m *Mailbox) Batch(msgs ...byte) {
+	m.BatchN(msgs, BatchWait)
+}
+
+// BatchN will send a batch of messages using the provided mode (See the "BatchMode"
+// constants for more information), the number of messages sent is returned along
+// with the state of the last attempted send
+func (m *Mailbox) BatchN(msgs []byte, mode BatchMode) (sent int, state StateCode) {
+	if m.sendFn != nil {
+		// Route our messages through the send interceptors
+		return m.batchIntercepted(msgs, mode)
+	}
+
+	return m.batchDirect(msgs, mode)
+}
+
+// batchDirect will send a batch of messages without going through the send interceptors
+func (m *Mailbox) batchDirect(msgs []byte, mode BatchMode) (sent int, state StateCode) {
 	m.mux.Lock()
 	if m.isClosed() {
+		state = StateClosed
+		goto END
+	}
+
+	if mode == BatchAtomic {
+		sent, state = m.batchAtomic(msgs)
 		goto END
 	}
 
 	// Iterate through each message
 	for _, msg := range msgs {
-		m.send(msg)
+		if state = m.send(msg, mode == BatchWait); state != StateOK {
+			// Mailbox is either full (when not waiting) or closed, return early
+			break
+		}
+
+		sent++
 	}
 
 END:
 	m.mux.Unlock()
+	return
+}
+
+// batchAtomic will wait until there is room for the entire batch and then send
+// all of the messages at once, so that they land contiguously
+// Note: Lock is expected to be held when calling
+func (m *Mailbox) batchAtomic(msgs []byte) (sent int, state StateCode) {
+	if len(msgs) > m.cap {
+		// Batch will never fit, return StateFull
+		return 0, StateFull
+	}
+
+	if m.codel != nil && m.codelShed() {
+		// Controlled delay is rejecting sends, the batch is rejected as a whole
+		return 0, StateShed
+	}
+
+	if m.cap-m.len < len(msgs) && m.hooks.OnFull != nil {
+		// Let our hook know that the batch found the mailbox full
+		m.hooks.OnFull()
+	}
+
+	// Let receivers know to notify on every vacated entry, not only when we go from full
+	m.aw++
+	for m.cap-m.len < len(msgs) {
+		if m.isClosed() {
+			m.aw--
+			return 0, StateClosed
+		}
+
+		m.sw++
+		m.block(nil, m.sc, sendWait)
+		m.sw--
+	}
+
+	m.aw--
+	if m.isClosed() {
+		// Our inbox was closed before receives made room for the batch, return StateClosed
+		return 0, StateClosed
+	}
+
+	for _, msg := range msgs {
+		m.write(msg)
+	}
+
+	return len(msgs), StateOK
 }
 
 // Receive will receive a message and state (See the "State" constants for more information)
-func (m *Mailbox) Receive() (msg byte, state StateCode) {
+func (m *Mailbox) Receive(wait bool) (msg byte, state StateCode) {
+	if m.receiveFn != nil {
+		// Route our receive through the receive interceptors
+		return m.receiveFn(wait)
+	}
+
+	return m.receiveDirect(wait)
+}
+
+// receiveDirect will receive a message without going through the receive interceptors
+func (m *Mailbox) receiveDirect(wait bool) (msg byte, state StateCode) {
 	m.mux.Lock()
-	msg, state = m.receive()
+	msg, state = m.receive(wait)
 	m.mux.Unlock()
 	return
 }
@@ -164,13 +468,19 @@ func (m *Mailbox) Receive() (msg byte, state StateCode) {
 // Listen will return all current and inbound messages until either:
 //	- The mailbox is empty and closed
 //	- The end boolean is returned
+// Note: When receive interceptors are installed, Listen receives through them and
+// the lock is no longer held while fn runs
 func (m *Mailbox) Listen(fn func(msg byte) (end bool)) (state StateCode) {
 	var msg byte
+	if m.receiveFn != nil {
+		return m.listenIntercepted(fn)
+	}
+
 	m.mux.Lock()
 	// Iterate until break is called
 	for {
 		// Get message and state
-		if msg, state = m.receive(); state != StateOK {
+		if msg, state = m.receive(true); state != StateOK {
 			// Receiving was not successful, break
 			break
 		}
@@ -187,6 +497,51 @@ func (m *Mailbox) Listen(fn func(msg byte) (end bool)) (state StateCode) {
 	return
 }
 
+// ReceiveAge will receive a message along with the time it spent in the mailbox
+// Note: Age is only known for mailboxes which track sojourn times (See Options), it is zero otherwise
+func (m *Mailbox) ReceiveAge(wait bool) (msg byte, age time.Duration, state StateCode) {
+	m.mux.Lock()
+	msg, age, state = m.receiveAge(wait)
+	m.mux.Unlock()
+	return
+}
+
+// ListenAge will behave like Listen, while also providing the time each message spent in the mailbox
+func (m *Mailbox) ListenAge(fn func(msg byte, age time.Duration) (end bool)) (state StateCode) {
+	var (
+		msg byte
+		age time.Duration
+	)
+
+	m.mux.Lock()
+	// Iterate until break is called
+	for {
+		// Get message, age and state
+		if msg, age, state = m.receiveAge(true); state != StateOK {
+			// Receiving was not successful, break
+			break
+		}
+
+		// Provide message and age to provided function
+		if fn(msg, age) {
+			// End was returned as true, set state accordingly and break
+			state = StateEnded
+			break
+		}
+	}
+
+	m.mux.Unlock()
+	return
+}
+
+// Len will return the number of messages currently in the mailbox
+func (m *Mailbox) Len() (n int) {
+	m.mux.Lock()
+	n = m.len
+	m.mux.Unlock()
+	return
+}
+
 // Close will close a mailbox
 func (m *Mailbox) Close() {
 	// Attempt to set closed state to 1 (from 0)
@@ -195,10 +550,26 @@ func (m *Mailbox) Close() {
 		return
 	}
 
+	// Release anything waiting on our done channel
+	close(m.done)
+
+	// Notify while holding the lock so that a waiter cannot miss the signal
+	// between checking the closed state and waiting
+	m.mux.Lock()
 	// Notify senders to attempt to send again
 	m.sc.Broadcast()
 	// Notify receivers to attempty to receive again
 	m.rc.Broadcast()
+	// Notify selectors to attempt their cases again
+	m.notifySelectors()
+	// Notify readiness channels so that waiters observe the closed state
+	signal(m.rr)
+	signal(m.rs)
+	m.mux.Unlock()
+
+	if m.hooks.OnClose != nil {
+		go m.hooks.OnClose()
+	}
 }
 
 // StateCode represents the state of a response
@@ -210,8 +581,38 @@ const (
 	// StateEmpty is returned when the request was empty
 	// Note: This will be used when the reject option is implemented
 	StateEmpty
+	// StateFull is returned when a receiving channel is full and wait is false for sending
+	StateFull
 	// StateEnded is returned when the client ends a listening
 	StateEnded
 	// StateClosed is returned when the calling mailbox is closed
 	StateClosed
+	// StateShed is returned when a send was rejected by load shedding (See CoDel and RateLimit)
+	StateShed
+	// StateRejected is returned when a send or receive was vetoed by an interceptor
+	StateRejected
+)
+
+// BatchMode represents the sending behaviour of a batch
+type BatchMode uint8
+
+const (
+	// BatchWait will wait for room for each message, returning early only when the mailbox is closed
+	BatchWait BatchMode = iota
+	// BatchNoWait will send as many messages as currently fit, returning StateFull when
+	// the batch did not fit entirely
+	BatchNoWait
+	// BatchAtomic will wait until there is room for the entire batch and send it at once,
+	// so that the messages land contiguously. A batch larger than the mailbox returns StateFull
+	BatchAtomic
 )
+
+// Interface defines the behaviour of a mailbox, it can be implemented
+// with a different type of elements.
+type Interface interface {
+	Send(msg byte, wait bool) (state StateCode)
+	Batch(msgs ...byte)
+	Receive(wait bool) (msg byte, state StateCode)
+	Listen(fn func(msg byte) (end bool)) (state StateCode)
+	Close()
+}
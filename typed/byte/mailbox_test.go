@@ -31,7 +31,7 @@ func TestMailbox(t *testing.T) {
 
 	go func() {
 		for _, si := range testSet {
-			mb.Send(si)
+			mb.Send(si, true)
 		}
 		mb.Close()
 		wg.Done()
@@ -59,7 +59,7 @@ func BenchmarkMailbox(b *testing.B) {
 	b.RunParallel(func(pb *testing.PB) {
 		var i byte
 		for pb.Next() {
-			mb.Send(i)
+			mb.Send(i, true)
 		}
 	})
 
@@ -0,0 +1,137 @@
+package mailbox
+
+import (
+	"math/rand"
+)
+
+// CaseDir is the direction of a select case
+type CaseDir uint8
+
+const (
+	// CaseRecv is a case which receives from its mailbox
+	CaseRecv CaseDir = iota
+	// CaseSend is a case which sends its message to its mailbox
+	CaseSend
+	// CaseDefault is the case which fires when no other case is ready
+	CaseDefault
+)
+
+// Case is a single case of a Select
+type Case struct {
+	Dir     CaseDir
+	Mailbox *Mailbox
+	// Msg is the message sent by a send case
+	Msg byte
+}
+
+// RecvCase returns a case which receives from the provided mailbox
+func RecvCase(mb *Mailbox) Case {
+	return Case{Dir: CaseRecv, Mailbox: mb}
+}
+
+// SendCase returns a case which sends the provided message to the provided mailbox
+func SendCase(mb *Mailbox, msg byte) Case {
+	return Case{Dir: CaseSend, Mailbox: mb, Msg: msg}
+}
+
+// DefaultCase returns a case which fires when no other case is ready
+func DefaultCase() Case {
+	return Case{Dir: CaseDefault}
+}
+
+// Select will wait until one of the provided cases is ready and fire it, the
+// index of the chosen case is returned along with its message (for a receive
+// case) and state. When several cases are ready, one is chosen at random.
+//
+// A case is ready when:
+//   - Receive case: the mailbox has a message (StateOK), or is empty and closed (StateClosed)
+//   - Send case: the mailbox has a vacant entry (StateOK), or is closed (StateClosed)
+//
+// Exactly one case fires, a message is never taken from (or given to) a mailbox
+// whose case was not chosen. If no case is ready and a default case is provided,
+// the default case is chosen with StateOK.
+func Select(cases ...Case) (chosen int, msg byte, state StateCode) {
+	var ch chan struct{}
+	dflt := -1
+	for {
+		// Visit our cases in a random order so that ready cases are chosen fairly
+		for _, i := range rand.Perm(len(cases)) {
+			c := &cases[i]
+			switch c.Dir {
+			case CaseRecv:
+				if msg, state = c.Mailbox.Receive(false); state != StateEmpty {
+					chosen = i
+					goto END
+				}
+
+			case CaseSend:
+				if state = c.Mailbox.Send(c.Msg, false); state != StateFull {
+					chosen = i
+					goto END
+				}
+
+			case CaseDefault:
+				dflt = i
+			}
+		}
+
+		if dflt != -1 {
+			chosen, state = dflt, StateOK
+			goto END
+		}
+
+		if ch == nil {
+			// Register with our mailboxes and check our cases once more, any change
+			// from this point on will notify us
+			ch = make(chan struct{}, 1)
+			for i := range cases {
+				if cases[i].Mailbox != nil {
+					cases[i].Mailbox.addSelector(ch)
+				}
+			}
+
+			continue
+		}
+
+		// Wait for one of our mailboxes to change
+		<-ch
+	}
+
+END:
+	if ch != nil {
+		for i := range cases {
+			if cases[i].Mailbox != nil {
+				cases[i].Mailbox.removeSelector(ch)
+			}
+		}
+	}
+
+	return
+}
+
+func (m *Mailbox) addSelector(ch chan struct{}) {
+	m.mux.Lock()
+	m.sel = append(m.sel, ch)
+	m.mux.Unlock()
+}
+
+func (m *Mailbox) removeSelector(ch chan struct{}) {
+	m.mux.Lock()
+	for i, sc := range m.sel {
+		if sc == ch {
+			// Remove the selector while retaining order
+			m.sel = append(m.sel[:i], m.sel[i+1:]...)
+			break
+		}
+	}
+
+	m.mux.Unlock()
+}
+
+// notifySelectors will notify all waiting selectors that the mailbox has changed
+// Note: Lock is expected to be held when calling
+func (m *Mailbox) notifySelectors() {
+	for _, ch := range m.sel {
+		signal(ch)
+	}
+}
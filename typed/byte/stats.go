@@ -0,0 +1,102 @@
+package mailbox
+
+// Stats is a snapshot of the state of a mailbox, all values are taken at the same instant
+type Stats struct {
+	// Sent is the total number of messages sent
+	Sent uint64
+	// Received is the total number of messages received
+	Received uint64
+	// Dropped is the total number of messages which were discarded before being received.
+	// Sends never overwrite messages, so only controlled delay drops them (See CoDel)
+	Dropped uint64
+	// Shed is the total number of sends rejected by load shedding, either by controlled
+	// delay (See CoDel) or by a send interceptor returning StateShed (See RateLimit)
+	Shed uint64
+
+	// Len is the current number of messages in the mailbox
+	Len int
+	// MaxLen is the largest number of messages the mailbox has held
+	MaxLen int
+	// Cap is the capacity of the mailbox
+	Cap int
+
+	// BlockedSenders is the number of senders currently waiting for a vacant entry
+	BlockedSenders int
+	// BlockedReceivers is the number of receivers currently waiting for a message
+	BlockedReceivers int
+
+	// Sojourn is the distribution of the time messages spent in the mailbox
+	// Note: Only populated for mailboxes which track sojourn times (See Options)
+	Sojourn Histogram
+
+	// Closed is whether or not the mailbox has been closed
+	Closed bool
+}
+
+// Stats will return a consistent snapshot of the mailbox statistics
+func (m *Mailbox) Stats() (s Stats) {
+	m.mux.Lock()
+	s = Stats{
+		Sent:     m.sent,
+		Received: m.received,
+		Dropped:  m.dropped,
+		Shed:     m.shed,
+
+		Len:    m.len,
+		MaxLen: m.maxLen,
+		Cap:    m.cap,
+
+		BlockedSenders:   m.sw,
+		BlockedReceivers: m.rw,
+
+		Closed: m.isClosed(),
+	}
+
+	if m.sojourn != nil {
+		s.Sojourn = *m.sojourn
+	}
+
+	m.mux.Unlock()
+	return
+}
+
+// Cap will return the capacity of the mailbox
+func (m *Mailbox) Cap() int {
+	// Capacity is fixed at creation, no lock is needed
+	return m.cap
+}
+
+// Peek will return the oldest message without removing it from the mailbox,
+// Peek does not wait for a message (See the "State" constants for more information)
+func (m *Mailbox) Peek() (msg byte, state StateCode) {
+	m.mux.Lock()
+	if state = m.rWait(nil, false); state == StateOK {
+		msg = m.s[m.head]
+	}
+
+	m.mux.Unlock()
+	return
+}
+
+// PeekN will return up to n of the oldest messages, oldest first, without removing
+// them from the mailbox
+func (m *Mailbox) PeekN(n int) (msgs []byte) {
+	m.mux.Lock()
+	if n > m.len {
+		n = m.len
+	}
+
+	if n > 0 {
+		msgs = make([]byte, n)
+		for i, idx := 0, m.head; i < n; i++ {
+			msgs[i] = m.s[idx]
+			if idx++; idx == m.cap {
+				// Our index falls out of the bounds of our internal slice, reset to 0
+				idx = 0
+			}
+		}
+	}
+
+	m.mux.Unlock()
+	return
+}
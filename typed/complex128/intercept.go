@@ -0,0 +1,319 @@
+package mailbox
+
+import (
+	"sync"
+	"time"
+)
+
+// SendFunc is a send of a single message, it has the signature of Send
+type SendFunc func(msg complex128, wait bool) (state StateCode)
+
+// ReceiveFunc is a receive of a single message, it has the signature of Receive
+type ReceiveFunc func(wait bool) (msg complex128, state StateCode)
+
+// SendInterceptor wraps the next send of a chain. An interceptor may validate,
+// transform, tag or sample the message before calling next, or veto the send by
+// returning without calling next (StateRejected is the conventional veto state).
+//
+// Interceptors are installed at construction (See Options) and run on the calling
+// goroutine without the mailbox lock held. Every send goes through the chain,
+// including Batch, BatchN and Select. For atomic batches, the chain of each message
+// calls into the chain of the next one and the innermost sends the batch at once,
+// so every interceptor sees the outcome of the whole batch and a veto of any
+// message rejects it.
+type SendInterceptor func(next SendFunc) SendFunc
+
+// ReceiveInterceptor wraps the next receive of a chain. An interceptor may inspect
+// or transform the received message, or filter it out by calling next again.
+//
+// Interceptors are installed at construction (See Options) and run on the calling
+// goroutine without the mailbox lock held. Every receive goes through the chain,
+// including Listen, All, Batches, ToChan and Select.
+// Note: ReceiveAge, ListenAge, Peek and PeekN do not go through the chain
+type ReceiveInterceptor func(next ReceiveFunc) ReceiveFunc
+
+// installing holds the done channel of the mailbox whose send chain is being built,
+// interceptors which wait (See RateLimit) use it to stop waiting once the mailbox is closed
+var installing struct {
+	sync.Mutex
+	done chan struct{}
+}
+
+// chainSend will wrap the provided send with the send interceptors of the mailbox
+func (m *Mailbox) chainSend(fn SendFunc) SendFunc {
+	installing.Lock()
+	defer installing.Unlock()
+	installing.done = m.done
+	defer func() { installing.done = nil }()
+	// Wrap in reverse so that the first interceptor is the outermost
+	for i := len(m.sendInterceptors) - 1; i >= 0; i-- {
+		fn = m.sendInterceptors[i](fn)
+	}
+
+	return fn
+}
+
+// countShed will wrap the provided send so that sends shed anywhere in the chain,
+// whether by an interceptor (See RateLimit) or by controlled delay, count towards Stats.Shed
+func (m *Mailbox) countShed(fn SendFunc) SendFunc {
+	return func(msg complex128, wait bool) (state StateCode) {
+		if state = fn(msg, wait); state == StateShed {
+			m.mux.Lock()
+			m.shed++
+			m.mux.Unlock()
+		}
+
+		return
+	}
+}
+
+// chainReceive will wrap the provided receive with the receive interceptors of the mailbox
+func (m *Mailbox) chainReceive(fn ReceiveFunc) ReceiveFunc {
+	// Wrap in reverse so that the first interceptor is the outermost
+	for i := len(m.receiveInterceptors) - 1; i >= 0; i-- {
+		fn = m.receiveInterceptors[i](fn)
+	}
+
+	return fn
+}
+
+// batchIntercepted is the BatchN equivalent for mailboxes with send interceptors
+func (m *Mailbox) batchIntercepted(msgs []complex128, mode BatchMode) (sent int, state StateCode) {
+	if mode == BatchAtomic {
+		return m.batchAtomicIntercepted(msgs)
+	}
+
+	// Iterate through each message, a vetoed message doesn't stop the rest of the batch
+	for _, msg := range msgs {
+		switch state = m.sendFn(msg, mode == BatchWait); state {
+		case StateOK:
+			sent++
+		case StateRejected, StateShed:
+		default:
+			// Mailbox is either full (when not waiting) or closed, return early
+			return
+		}
+	}
+
+	return
+}
+
+// batchAtomicIntercepted is the atomic BatchN equivalent for mailboxes with send interceptors
+func (m *Mailbox) batchAtomicIntercepted(msgs []complex128) (sent int, state StateCode) {
+	var (
+		batch = make([]complex128, 0, len(msgs))
+		// i is the index of the next message to go through the chain
+		i int
+		// end is set once the batch has been sent or vetoed
+		end  bool
+		next func() StateCode
+	)
+
+	// The innermost send of each message calls next, so the chain of the first message
+	// only returns once the batch has been sent and sees the outcome of the whole batch
+	chain := m.chainSend(func(msg complex128, _ bool) StateCode {
+		if end {
+			// Our batch has already been sent or vetoed
+			return StateRejected
+		}
+
+		batch = append(batch, msg)
+		return next()
+	})
+
+	next = func() (state StateCode) {
+		for i < len(msgs) {
+			msg := msgs[i]
+			i++
+			if state = chain(msg, true); end || state != StateOK {
+				// Our batch was either sent or vetoed
+				end = true
+				return
+			}
+
+			// The message was filtered out, continue with the next one
+		}
+
+		end = true
+		sent, state = m.batchDirect(batch, BatchAtomic)
+		return
+	}
+
+	if state = next(); state == StateShed {
+		m.mux.Lock()
+		m.shed++
+		m.mux.Unlock()
+	}
+
+	return
+}
+
+// listenIntercepted is the Listen equivalent for mailboxes with receive interceptors
+func (m *Mailbox) listenIntercepted(fn func(msg complex128) (end bool)) (state StateCode) {
+	var msg complex128
+	for {
+		if msg, state = m.receiveFn(true); state != StateOK {
+			// Receiving was not successful, break
+			break
+		}
+
+		if fn(msg) {
+			// End was returned as true, set state accordingly and break
+			state = StateEnded
+			break
+		}
+	}
+
+	return
+}
+
+// receiveBatchIntercepted is the receiveBatch equivalent for mailboxes with receive interceptors
+func (m *Mailbox) receiveBatchIntercepted(n int) (msgs []complex128, state StateCode) {
+	var msg complex128
+	if msg, state = m.receiveFn(true); state != StateOK {
+		return
+	}
+
+	msgs = append(msgs, msg)
+	for len(msgs) < n {
+		if msg, state = m.receiveFn(false); state != StateOK {
+			// No more messages are available, our batch is complete
+			state = StateOK
+			break
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	return
+}
+
+// ObserveSend returns a send interceptor which calls the provided function after
+// every send with the message, resulting state and time spent sending. It is the
+// building block for send metrics, e.g. counting sends by state or timing blocked sends
+func ObserveSend(fn func(msg complex128, state StateCode, elapsed time.Duration)) SendInterceptor {
+	return func(next SendFunc) SendFunc {
+		return func(msg complex128, wait bool) (state StateCode) {
+			start := time.Now()
+			state = next(msg, wait)
+			fn(msg, state, time.Since(start))
+			return
+		}
+	}
+}
+
+// ObserveReceive returns a receive interceptor which calls the provided function
+// after every receive with the message, resulting state and time spent receiving
+func ObserveReceive(fn func(msg complex128, state StateCode, elapsed time.Duration)) ReceiveInterceptor {
+	return func(next ReceiveFunc) ReceiveFunc {
+		return func(wait bool) (msg complex128, state StateCode) {
+			start := time.Now()
+			msg, state = next(wait)
+			fn(msg, state, time.Since(start))
+			return
+		}
+	}
+}
+
+// RecoverSend returns a send interceptor which recovers panics raised by the
+// interceptors it wraps, the provided function (when not nil) is called with the
+// recovered value and the send returns StateRejected
+func RecoverSend(fn func(v any)) SendInterceptor {
+	return func(next SendFunc) SendFunc {
+		return func(msg complex128, wait bool) (state StateCode) {
+			defer func() {
+				if v := recover(); v != nil {
+					if fn != nil {
+						fn(v)
+					}
+
+					state = StateRejected
+				}
+			}()
+
+			return next(msg, wait)
+		}
+	}
+}
+
+// RecoverReceive returns a receive interceptor which recovers panics raised by the
+// interceptors it wraps, the provided function (when not nil) is called with the
+// recovered value and the receive returns StateRejected
+// Note: A message taken from the mailbox before the panic is lost
+func RecoverReceive(fn func(v any)) ReceiveInterceptor {
+	return func(next ReceiveFunc) ReceiveFunc {
+		return func(wait bool) (msg complex128, state StateCode) {
+			defer func() {
+				if v := recover(); v != nil {
+					if fn != nil {
+						fn(v)
+					}
+
+					msg, state = empty, StateRejected
+				}
+			}()
+
+			return next(wait)
+		}
+	}
+}
+
+// RateLimit returns a send interceptor which limits sends to rate messages per
+// second, allowing bursts of up to burst messages. A waiting send waits for its
+// turn (or until the mailbox is closed), a send which isn't waiting returns
+// StateShed when over the limit.
+// The limit is shared by every mailbox the returned interceptor is installed on.
+// Rate must be positive and burst at least 1, RateLimit panics otherwise.
+func RateLimit(rate float64, burst int) SendInterceptor {
+	if !(rate > 0) || burst < 1 {
+		panic("mailbox: rate limit needs a positive rate and a burst of at least 1")
+	}
+
+	var (
+		mux    sync.Mutex
+		tokens = float64(burst)
+		last   = time.Now()
+	)
+
+	// take will take a token, the time until a token is available is returned when there are none
+	take := func() (delay time.Duration) {
+		mux.Lock()
+		defer mux.Unlock()
+		now := time.Now()
+		// Refill our bucket for the time which has passed
+		tokens = min(float64(burst), tokens+now.Sub(last).Seconds()*rate)
+		last = now
+		if tokens >= 1 {
+			tokens--
+			return 0
+		}
+
+		return max(time.Duration((1-tokens)/rate*float64(time.Second)), time.Nanosecond)
+	}
+
+	return func(next SendFunc) SendFunc {
+		// done is closed along with the mailbox this chain is installed on
+		done := installing.done
+		return func(msg complex128, wait bool) (state StateCode) {
+			for {
+				delay := take()
+				if delay == 0 {
+					return next(msg, wait)
+				}
+
+				if !wait {
+					return StateShed
+				}
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-timer.C:
+				case <-done:
+					// Mailbox was closed while waiting, let the send report it
+					timer.Stop()
+					return next(msg, false)
+				}
+			}
+		}
+	}
+}
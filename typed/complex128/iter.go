@@ -0,0 +1,83 @@
+package mailbox
+
+import (
+	"iter"
+)
+
+// All returns an iterator over all current and inbound messages, it is the range
+// equivalent of Listen:
+//
+//	for msg := range mb.All() {
+//		...
+//	}
+//
+// The loop ends once the mailbox is empty and closed (StateClosed), breaking out
+// of the loop is the equivalent of returning end from Listen (StateEnded).
+// Unlike Listen, the mailbox lock is not held while the loop body runs, so the
+// body is free to call into the mailbox and the iterator may be used with iter.Pull.
+func (m *Mailbox) All() iter.Seq[complex128] {
+	return func(yield func(complex128) bool) {
+		for {
+			msg, state := m.Receive(true)
+			if state != StateOK {
+				// Our mailbox is empty and closed
+				return
+			}
+
+			if !yield(msg) {
+				// Our consumer has ended iteration
+				return
+			}
+		}
+	}
+}
+
+// Batches returns an iterator over all current and inbound messages in batches of
+// up to n messages. Each batch waits for at least one message and then takes up to
+// n-1 more messages which are already available, without waiting for them.
+// Each yielded batch is a new slice which the loop body may retain.
+// See All for loop and locking semantics.
+func (m *Mailbox) Batches(n int) iter.Seq[[]complex128] {
+	if n < 1 {
+		n = 1
+	}
+
+	return func(yield func([]complex128) bool) {
+		for {
+			msgs, state := m.receiveBatch(n)
+			if state != StateOK {
+				// Our mailbox is empty and closed
+				return
+			}
+
+			if !yield(msgs) {
+				// Our consumer has ended iteration
+				return
+			}
+		}
+	}
+}
+
+// receiveBatch will wait for a message and then receive up to n-1 available messages
+func (m *Mailbox) receiveBatch(n int) (msgs []complex128, state StateCode) {
+	var msg complex128
+	if m.receiveFn != nil {
+		return m.receiveBatchIntercepted(n)
+	}
+
+	m.mux.Lock()
+	if msg, state = m.receive(true); state != StateOK {
+		goto END
+	}
+
+	msgs = make([]complex128, 1, min(n, m.len+1))
+	msgs[0] = msg
+	for len(msgs) < n && m.len > 0 {
+		msg, _ = m.receive(false)
+		msgs = append(msgs, msg)
+	}
+
+END:
+	m.mux.Unlock()
+	return
+}
@@ -0,0 +1,81 @@
+package mailbox
+
+import (
+	"context"
+)
+
+// FromChan will pump messages from the provided channel into the provided mailbox
+// until either:
+//   - The channel is closed, at which point the mailbox is closed
+//   - The mailbox is closed
+//
+// Messages which the mailbox does not accept (StateShed or StateRejected, See CoDel
+// and SendInterceptor) are passed to onReject along with their state, when not nil
+func FromChan(ch <-chan complex64, mb *Mailbox, onReject func(msg complex64, state StateCode)) {
+	go func() {
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					// Our input channel has been closed, close the mailbox
+					mb.Close()
+					return
+				}
+
+				switch state := mb.Send(msg, true); state {
+				case StateOK:
+				case StateClosed:
+					return
+				default:
+					if onReject != nil {
+						onReject(msg, state)
+					}
+				}
+
+			case <-mb.done:
+				// Our mailbox was closed while we were waiting for a message
+				return
+			}
+		}
+	}()
+}
+
+// ToChan will return a channel with the provided buffer size which receives all
+// current and inbound messages. The channel is closed once either:
+//   - The mailbox is closed and all remaining messages have been delivered
+//   - The context is done, a reader which stops reading early must cancel it so
+//     that the goroutine feeding the channel does not remain blocked
+func (m *Mailbox) ToChan(ctx context.Context, buf int) <-chan complex64 {
+	ch := make(chan complex64, buf)
+	// stop is closed once our context is done, releasing a waiting receive
+	stop := New(1)
+	release := context.AfterFunc(ctx, stop.Close)
+	go func() {
+		defer close(ch)
+		defer release()
+		for {
+			msg, state := m.Receive(false)
+			if state == StateEmpty {
+				var chosen int
+				if chosen, msg, state = Select(RecvCase(m), RecvCase(stop)); chosen != 0 {
+					// Our context is done
+					return
+				}
+			}
+
+			if state != StateOK {
+				// Our mailbox is empty and closed
+				return
+			}
+
+			select {
+			case ch <- msg:
+			case <-ctx.Done():
+				// Our reader has stopped, the message in hand is lost
+				return
+			}
+		}
+	}()
+
+	return ch
+}
@@ -0,0 +1,205 @@
+//go:build ignore
+
+// conformance.go generates the conformance test of every typed package from the
+// gengen directives of typed.go, run it with `go generate` alongside gengen
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// base describes how the conformance suite builds and indexes messages of an element type
+type base struct {
+	// value is the expression of the value for i, index the expression (a format of the
+	// value) of the index of a value
+	value string
+	index string
+	// distinct is the number of distinct values, zero when there are enough of them
+	distinct int
+	// imports are the imports needed by value and index
+	imports []string
+	// helpers are the helper functions needed by value and index
+	helpers string
+}
+
+var bases = map[string]base{
+	"int":            {value: "int(i)", index: "int(%s)"},
+	"int8":           {value: "int8(i % 128)", index: "int(%s)", distinct: 128},
+	"int16":          {value: "int16(i)", index: "int(%s)"},
+	"int32":          {value: "int32(i)", index: "int(%s)"},
+	"int64":          {value: "int64(i)", index: "int(%s)"},
+	"uint":           {value: "uint(i)", index: "int(%s)"},
+	"uint8":          {value: "uint8(i)", index: "int(%s)", distinct: 256},
+	"uint16":         {value: "uint16(i)", index: "int(%s)"},
+	"uint32":         {value: "uint32(i)", index: "int(%s)"},
+	"uint64":         {value: "uint64(i)", index: "int(%s)"},
+	"uintptr":        {value: "uintptr(i)", index: "int(%s)"},
+	"byte":           {value: "byte(i)", index: "int(%s)", distinct: 256},
+	"rune":           {value: "rune(i)", index: "int(%s)"},
+	"float32":        {value: "float32(i)", index: "int(%s)"},
+	"float64":        {value: "float64(i)", index: "int(%s)"},
+	"complex64":      {value: "complex64(complex(float64(i), 0))", index: "int(real(%s))"},
+	"complex128":     {value: "complex128(complex(float64(i), 0))", index: "int(real(%s))"},
+	"unsafe.Pointer": {value: "unsafe.Pointer(&i)", index: "*(*int)(%s)", imports: []string{"unsafe"}},
+	"struct{}":       {value: "struct{}{}", index: "0", distinct: 1},
+	"string":         {value: "strconv.Itoa(i)", index: "atoi(%s)", imports: []string{"strconv"}, helpers: atoi},
+	"Interface":      {value: "newIface(i)", index: "ifaceIndex(%s)", imports: []string{"sync"}, helpers: iface},
+}
+
+const atoi = `
+func atoi(s string) (i int) {
+	i, _ = strconv.Atoi(s)
+	return
+}
+`
+
+const iface = `
+var (
+	ifaceMux     sync.Mutex
+	ifaceIndexes = make(map[Interface]int)
+)
+
+// newIface will return a new mailbox to be sent as the message for i
+func newIface(i int) Interface {
+	mb := New(1)
+	ifaceMux.Lock()
+	ifaceIndexes[mb] = i
+	ifaceMux.Unlock()
+	return mb
+}
+
+// ifaceIndex will return the index of a mailbox returned by newIface
+func ifaceIndex(msg Interface) (i int) {
+	ifaceMux.Lock()
+	i = ifaceIndexes[msg]
+	ifaceMux.Unlock()
+	return
+}
+`
+
+var tmpl = template.Must(template.New("conformance").Parse(`// Code generated by conformance.go; DO NOT EDIT.
+
+package mailbox
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+
+	"github.com/itsmontoya/mailbox/mailboxtest"
+)
+
+func TestConformance(t *testing.T) {
+	mailboxtest.Run(t, mailboxtest.Factory[{{.Type}}, StateCode]{
+		New: func(sz int) mailboxtest.Mailbox[{{.Type}}, StateCode] { return New(sz) },
+		States: mailboxtest.States[StateCode]{
+			OK:     StateOK,
+			Empty:  StateEmpty,
+			Full:   StateFull,
+			Ended:  StateEnded,
+			Closed: StateClosed,
+		},
+		{{- if .Pointer}}
+		Message: func(i int) {{.Type}} {
+			v := {{.Value}}
+			return {{.Wrap}}
+		},
+		{{- else}}
+		Message: func(i int) {{.Type}} { return {{.Wrap}} },
+		{{- end}}
+		Index: func(msg {{.Type}}) int { return {{.Index}} },
+		{{- if .Distinct}}
+		Distinct: {{.Distinct}},
+		{{- end}}
+	})
+}
+{{.Helpers}}`))
+
+func main() {
+	f, err := os.Open("typed.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// Directives are formatted as: //go:generate gengen -o <dir> <package> <type>
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 6 || fields[0] != "//go:generate" || fields[1] != "gengen" {
+			continue
+		}
+
+		if err = generate(fields[3], fields[5]); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err = sc.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate will write the conformance test of the package in dir, for elements of typ
+func generate(dir, typ string) (err error) {
+	var buf bytes.Buffer
+	name := strings.TrimPrefix(typ, "[]")
+	slice := name != typ
+	elem := strings.TrimPrefix(name, "*")
+	pointer := elem != name
+
+	b, ok := bases[elem]
+	if !ok {
+		log.Fatalf("no conformance messages for element type %s", typ)
+	}
+
+	// value is the element (v when it is a pointer), at is where the value is read from
+	value, at := b.value, "msg"
+	if slice {
+		at += "[0]"
+	}
+
+	if pointer {
+		value, at = "&v", "*"+at
+	}
+
+	if slice {
+		value = typ + "{" + value + "}"
+	}
+
+	index := b.index
+	if strings.Contains(index, "%s") {
+		index = fmt.Sprintf(index, at)
+	}
+
+	imports := append([]string{"testing"}, b.imports...)
+	sort.Strings(imports)
+	if err = tmpl.Execute(&buf, map[string]any{
+		"Imports":  imports,
+		"Type":     typ,
+		"Pointer":  pointer,
+		"Value":    b.value,
+		"Wrap":     value,
+		"Index":    index,
+		"Distinct": b.distinct,
+		"Helpers":  b.helpers,
+	}); err != nil {
+		return
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return
+	}
+
+	return os.WriteFile(filepath.Join(dir, "conformance_test.go"), src, 0644)
+}
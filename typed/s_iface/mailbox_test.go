@@ -6,7 +6,7 @@ import (
 )
 
 var (
-	testVal []MailboxIface
+	testVal []Interface
 
 	testBufSize = 128
 	testSet     = getList(8192)
@@ -20,7 +20,7 @@ func TestMailbox(t *testing.T) {
 	mb := New(testBufSize)
 
 	go func() {
-		mb.Listen(func(item []MailboxIface) (end bool) {
+		mb.Listen(func(item []Interface) (end bool) {
 			testVal = item
 			cnt++
 			return
@@ -31,7 +31,7 @@ func TestMailbox(t *testing.T) {
 
 	go func() {
 		for _, si := range testSet {
-			mb.Send(si)
+			mb.Send(si, true)
 		}
 		mb.Close()
 		wg.Done()
@@ -49,7 +49,7 @@ func BenchmarkMailbox(b *testing.B) {
 	rwg.Add(1)
 
 	go func() {
-		mb.Listen(func(item []MailboxIface) (end bool) {
+		mb.Listen(func(item []Interface) (end bool) {
 			testVal = item
 			return
 		})
@@ -57,9 +57,9 @@ func BenchmarkMailbox(b *testing.B) {
 	}()
 
 	b.RunParallel(func(pb *testing.PB) {
-		var i []MailboxIface
+		var i []Interface
 		for pb.Next() {
-			mb.Send(i)
+			mb.Send(i, true)
 		}
 	})
 
@@ -71,7 +71,7 @@ func BenchmarkMailbox(b *testing.B) {
 
 func BenchmarkChannel(b *testing.B) {
 	var rwg sync.WaitGroup
-	ch := make(chan []MailboxIface, testBufSize)
+	ch := make(chan []Interface, testBufSize)
 	rwg.Add(1)
 
 	go func() {
@@ -83,7 +83,7 @@ func BenchmarkChannel(b *testing.B) {
 	}()
 
 	b.RunParallel(func(pb *testing.PB) {
-		var i []MailboxIface
+		var i []Interface
 		for pb.Next() {
 			ch <- i
 		}
@@ -101,7 +101,7 @@ func BenchmarkBatchMailbox(b *testing.B) {
 	rwg.Add(1)
 
 	go func() {
-		mb.Listen(func(item []MailboxIface) (end bool) {
+		mb.Listen(func(item []Interface) (end bool) {
 			testVal = item
 			return
 		})
@@ -122,7 +122,7 @@ func BenchmarkBatchMailbox(b *testing.B) {
 
 func BenchmarkBatchChannel(b *testing.B) {
 	var rwg sync.WaitGroup
-	ch := make(chan []MailboxIface, testBufSize)
+	ch := make(chan []Interface, testBufSize)
 	rwg.Add(1)
 
 	go func() {
@@ -147,8 +147,8 @@ func BenchmarkBatchChannel(b *testing.B) {
 	b.ReportAllocs()
 }
 
-func getList(n int) (l [][]MailboxIface) {
-	l = make([][]MailboxIface, n)
+func getList(n int) (l [][]Interface) {
+	l = make([][]Interface, n)
 	for i := range l {
 		l[i] = empty
 	}
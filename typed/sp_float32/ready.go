@@ -0,0 +1,68 @@
+package mailbox
+
+// ReadyToReceive returns a channel which is notified when the mailbox goes from
+// empty to having a message, or when the mailbox is closed. It allows a mailbox
+// to be used within a select statement:
+//
+//	for {
+//		msg, state := mb.Receive(false)
+//		switch state {
+//		case StateOK:
+//			handle(msg)
+//			continue
+//		case StateClosed:
+//			return
+//		}
+//
+//		select {
+//		case <-mb.ReadyToReceive():
+//		case <-ctx.Done():
+//			return
+//		}
+//	}
+//
+// The channel is edge-triggered and shared by all callers, a notification wakes
+// a single waiter. Callers should receive until StateEmpty before waiting again.
+// If the mailbox already has a message when the channel is first requested, the
+// channel starts out notified.
+func (m *Mailbox) ReadyToReceive() <-chan struct{} {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.rr == nil {
+		m.rr = make(chan struct{}, 1)
+		if m.len > 0 || m.isClosed() {
+			signal(m.rr)
+		}
+	}
+
+	return m.rr
+}
+
+// ReadyToSend returns a channel which is notified when the mailbox goes from full
+// to having a vacant entry, or when the mailbox is closed.
+//
+// The channel is edge-triggered and shared by all callers, a notification wakes
+// a single waiter. Callers should send until StateFull before waiting again.
+// If the mailbox already has a vacant entry when the channel is first requested,
+// the channel starts out notified.
+func (m *Mailbox) ReadyToSend() <-chan struct{} {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if m.rs == nil {
+		m.rs = make(chan struct{}, 1)
+		if m.len < m.cap || m.isClosed() {
+			signal(m.rs)
+		}
+	}
+
+	return m.rs
+}
+
+// signal will notify the provided channel without blocking, a nil channel is ignored
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+		// Channel is nil or has already been notified
+	}
+}
@@ -0,0 +1,25 @@
+package mailbox
+
+import "time"
+
+// Options are the options used to create a mailbox (See NewWithOptions)
+type Options struct {
+	// TrackSojourn will record the time every message is sent, so that the time it
+	// spends in the mailbox is known when it is received. See ReceiveAge, ListenAge
+	// and the Sojourn histogram of Stats
+	TrackSojourn bool
+	// Clock is used to timestamp messages, time.Now is used when nil
+	Clock func() time.Time
+	// CoDel enables controlled delay load shedding when set, sojourn times are
+	// tracked regardless of TrackSojourn
+	CoDel *CoDel
+	// Hooks are called at well-defined points of the mailbox lifecycle (See Hooks)
+	Hooks Hooks
+	// SendInterceptors wrap every send, the first interceptor is the outermost (See SendInterceptor)
+	SendInterceptors []SendInterceptor
+	// ReceiveInterceptors wrap every receive, the first interceptor is the outermost (See ReceiveInterceptor)
+	ReceiveInterceptors []ReceiveInterceptor
+	// Scheduler creates the conds blocked senders and receivers wait on, the Go
+	// runtime schedules them when nil (See Scheduler)
+	Scheduler Scheduler
+}
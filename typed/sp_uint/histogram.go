@@ -0,0 +1,166 @@
+package mailbox
+
+import (
+	"encoding/json"
+	"math/bits"
+	"time"
+)
+
+const (
+	// histSubBits is the number of bits of precision kept within each power of two
+	histSubBits = 3
+	// histSub is the number of buckets per power of two
+	histSub = 1 << histSubBits
+	// histBuckets is the number of buckets needed to cover every positive int64 nanosecond value
+	histBuckets = (64 - histSubBits) * histSub
+)
+
+// Histogram is an HDR-style log-linear histogram of durations. Every power of two
+// is split into 8 linear buckets, so a recorded value is within 12.5% of its bucket.
+// The zero value is an empty histogram ready for use.
+// Note: Histogram is not safe for concurrent use, the mailbox guards its own
+type Histogram struct {
+	counts [histBuckets]uint64
+
+	count uint64
+	sum   time.Duration
+	min   time.Duration
+	max   time.Duration
+}
+
+// Record will add the provided duration to the histogram, negative durations are recorded as zero
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+
+	h.counts[histIndex(uint64(d))]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+
+	if d > h.max {
+		h.max = d
+	}
+
+	h.count++
+	h.sum += d
+}
+
+// Count will return the number of recorded durations
+func (h *Histogram) Count() uint64 {
+	return h.count
+}
+
+// Sum will return the total of all recorded durations
+func (h *Histogram) Sum() time.Duration {
+	return h.sum
+}
+
+// Min will return the smallest recorded duration
+func (h *Histogram) Min() time.Duration {
+	return h.min
+}
+
+// Max will return the largest recorded duration
+func (h *Histogram) Max() time.Duration {
+	return h.max
+}
+
+// Mean will return the mean of all recorded durations
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	return h.sum / time.Duration(h.count)
+}
+
+// Quantile will return the duration at the provided quantile (0 to 1), the upper
+// bound of the matching bucket is returned, capped by the largest recorded duration
+func (h *Histogram) Quantile(q float64) (d time.Duration) {
+	var seen uint64
+	if h.count == 0 {
+		return
+	}
+
+	// Determine the rank of our quantile, rounding up so that q=1 is the max
+	rank := uint64(q*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	} else if rank > h.count {
+		rank = h.count
+	}
+
+	for i, n := range h.counts {
+		if seen += n; seen >= rank {
+			d = time.Duration(histUpper(i))
+			break
+		}
+	}
+
+	if d > h.max {
+		d = h.max
+	}
+
+	return
+}
+
+// ForEach will call the provided function for every non-empty bucket in ascending
+// order with the bucket's inclusive lower and upper bounds and count. Iteration stops
+// early when end is returned as true
+func (h *Histogram) ForEach(fn func(lower, upper time.Duration, count uint64) (end bool)) {
+	for i, n := range h.counts {
+		if n == 0 {
+			continue
+		}
+
+		if fn(time.Duration(histLower(i)), time.Duration(histUpper(i)), n) {
+			return
+		}
+	}
+}
+
+// MarshalJSON will marshal a summary of the histogram, durations are in nanoseconds
+func (h Histogram) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Count uint64        `json:"count"`
+		Min   time.Duration `json:"min"`
+		Max   time.Duration `json:"max"`
+		Mean  time.Duration `json:"mean"`
+		P50   time.Duration `json:"p50"`
+		P90   time.Duration `json:"p90"`
+		P99   time.Duration `json:"p99"`
+	}{h.count, h.min, h.max, h.Mean(), h.Quantile(0.5), h.Quantile(0.9), h.Quantile(0.99)})
+}
+
+// histIndex will return the bucket index for the provided value
+func histIndex(v uint64) int {
+	if v < histSub*2 {
+		// Values below 16 have a bucket each
+		return int(v)
+	}
+
+	// Keep the top 4 bits, the leading bit plus 3 bits of precision
+	shift := bits.Len64(v) - (histSubBits + 1)
+	return shift*histSub + int(v>>shift)
+}
+
+// histLower will return the inclusive lower bound of the provided bucket
+func histLower(i int) uint64 {
+	if i < histSub*2 {
+		return uint64(i)
+	}
+
+	return histUpper(i-1) + 1
+}
+
+// histUpper will return the inclusive upper bound of the provided bucket
+func histUpper(i int) uint64 {
+	if i < histSub*2 {
+		return uint64(i)
+	}
+
+	shift := i/histSub - 1
+	return (uint64(i-shift*histSub)+1)<<shift - 1
+}
@@ -0,0 +1,29 @@
+package mailbox
+
+import "sync"
+
+// Cond is a condition variable senders and receivers wait on, *sync.Cond is a Cond.
+// It is an alias of an interface literal so that a single Scheduler satisfies the
+// Options of every typed mailbox package
+type Cond = interface {
+	// Wait will unlock the locker of the cond, wait to be woken and lock it again
+	Wait()
+	// Broadcast will wake every waiter
+	Broadcast()
+}
+
+// Scheduler creates the conds a mailbox waits on. It allows tests to take control
+// of which blocked senders and receivers resume, and when, so that interleavings
+// can be explored deterministically (See mailboxtest/sim)
+// Note: Only Send, Batch, Receive and Listen (and their variants) wait through the
+// scheduler, Select and the readiness channels do not
+type Scheduler interface {
+	NewCond(l sync.Locker) Cond
+}
+
+// syncScheduler is the default scheduler, waits are handled by the Go runtime
+type syncScheduler struct{}
+
+func (syncScheduler) NewCond(l sync.Locker) Cond {
+	return sync.NewCond(l)
+}
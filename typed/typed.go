@@ -22,7 +22,7 @@ package typed
 //go:generate gengen -o byte github.com/itsmontoya/mailbox byte
 //go:generate gengen -o rune github.com/itsmontoya/mailbox rune
 //go:generate gengen -o string github.com/itsmontoya/mailbox string
-//go:generate gengen -o iface github.com/itsmontoya/mailbox MailboxIface
+//go:generate gengen -o iface github.com/itsmontoya/mailbox Interface
 
 //go:generate gengen -o p_int github.com/itsmontoya/mailbox *int
 //go:generate gengen -o p_int8 github.com/itsmontoya/mailbox *int8
@@ -86,4 +86,7 @@ package typed
 //go:generate gengen -o s_byte github.com/itsmontoya/mailbox []byte
 //go:generate gengen -o s_rune github.com/itsmontoya/mailbox []rune
 //go:generate gengen -o s_string github.com/itsmontoya/mailbox []string
-//go:generate gengen -o s_iface github.com/itsmontoya/mailbox []MailboxIface
+//go:generate gengen -o s_iface github.com/itsmontoya/mailbox []Interface
+
+// Conformance tests are generated from the directives above
+//go:generate go run conformance.go
@@ -0,0 +1,178 @@
+package mailbox
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// DefaultCoDelTarget is the default acceptable standing sojourn time
+	DefaultCoDelTarget = 5 * time.Millisecond
+	// DefaultCoDelInterval is the default window in which the sojourn time must fall below target
+	DefaultCoDelInterval = 100 * time.Millisecond
+)
+
+// CoDel are the options of controlled delay load shedding (See Options). Once the
+// sojourn time of received messages has stayed above Target for at least Interval,
+// the mailbox starts shedding load. Shedding happens at an increasing rate (Interval
+// divided by the square root of the number of sheds) until a received message has
+// spent less than Target in the mailbox, or the mailbox is drained.
+//
+// Load is shed in one of two ways:
+//   - By default, messages are dropped at the head as they are received. Drops are
+//     counted in the Dropped statistic
+//   - When Reject is set, sends are rejected with StateShed instead. Rejections are
+//     counted in the Shed statistic
+type CoDel struct {
+	// Target is the acceptable standing sojourn time, DefaultCoDelTarget is used when zero
+	Target time.Duration
+	// Interval is the window in which the sojourn time must fall below Target,
+	// DefaultCoDelInterval is used when zero
+	Interval time.Duration
+	// Reject will reject sends with StateShed rather than dropping messages at the head
+	Reject bool
+}
+
+func newCodel(opts CoDel) *codel {
+	if opts.Target <= 0 {
+		opts.Target = DefaultCoDelTarget
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultCoDelInterval
+	}
+
+	return &codel{CoDel: opts}
+}
+
+// codel is the state of the controlled delay algorithm (See RFC 8289)
+type codel struct {
+	CoDel
+
+	// firstAbove is the time at which the sojourn time will have been above target
+	// for an entire interval, zero when the sojourn time is below target
+	firstAbove time.Time
+	// dropNext is the time of the next shed while dropping
+	dropNext time.Time
+	// count is the number of sheds since entering the dropping state
+	count int
+	// lastCount is the count of the previous dropping state
+	lastCount int
+	// dropping is whether or not we are shedding load
+	dropping bool
+	// pending is the number of sends to reject, only used when rejecting
+	pending int
+}
+
+// okToDrop will return whether or not the sojourn time has stayed above target
+// for at least an interval
+func (c *codel) okToDrop(now time.Time, age time.Duration, n int) bool {
+	if age < c.Target || n <= 1 {
+		// Sojourn time is below target, or this is the last message in the mailbox
+		c.firstAbove = time.Time{}
+		return false
+	}
+
+	if c.firstAbove.IsZero() {
+		// We just went above target, give the consumers an interval to catch up
+		c.firstAbove = now.Add(c.Interval)
+		return false
+	}
+
+	return !now.Before(c.firstAbove)
+}
+
+// controlLaw will return the time of the next shed
+func (c *codel) controlLaw(t time.Time) time.Time {
+	return t.Add(time.Duration(float64(c.Interval) / math.Sqrt(float64(c.count))))
+}
+
+// codelDequeue will run the controlled delay algorithm for the message at the head,
+// which may be dropped. The sojourn time of the resulting head is returned
+// Note: Lock is expected to be held and the mailbox is expected to have a message
+func (m *Mailbox) codelDequeue(now time.Time, age time.Duration) time.Duration {
+	c := m.codel
+	ok := c.okToDrop(now, age, m.len)
+	if c.dropping {
+		if !ok {
+			// Sojourn time went below target, leave the dropping state
+			c.dropping = false
+			c.pending = 0
+			return age
+		}
+
+		if c.Reject {
+			if !now.Before(c.dropNext) {
+				// Reject the next send rather than dropping, at most once per receive
+				c.pending++
+				c.count++
+				c.dropNext = c.controlLaw(c.dropNext)
+			}
+
+			return age
+		}
+
+		for c.dropping && !now.Before(c.dropNext) {
+			age = m.codelDrop(now)
+			c.count++
+			if !c.okToDrop(now, age, m.len) {
+				// Sojourn time went below target, leave the dropping state
+				c.dropping = false
+				break
+			}
+
+			c.dropNext = c.controlLaw(c.dropNext)
+		}
+
+		return age
+	}
+
+	if !ok {
+		return age
+	}
+
+	if c.Reject {
+		c.pending++
+	} else {
+		age = m.codelDrop(now)
+	}
+
+	c.dropping = true
+	// Resume close to the previous shedding rate if we only recently left the dropping state
+	delta := c.count - c.lastCount
+	c.count = 1
+	if delta > 1 && now.Sub(c.dropNext) < 16*c.Interval {
+		c.count = delta
+	}
+
+	c.dropNext = c.controlLaw(now)
+	c.lastCount = c.count
+	return age
+}
+
+// codelDrop will drop the message at the head and return the sojourn time of the new head
+func (m *Mailbox) codelDrop(now time.Time) time.Duration {
+	if m.hooks.OnDrop != nil {
+		m.hooks.OnDrop(m.s[m.head])
+	}
+
+	m.dropped++
+	m.remove()
+	return now.Sub(m.ts[m.head])
+}
+
+// codelShed will return whether or not the next send is to be rejected
+// Note: Lock is expected to be held when calling
+func (m *Mailbox) codelShed() bool {
+	if m.codel.pending == 0 {
+		return false
+	}
+
+	m.codel.pending--
+	if m.sendFn == nil {
+		// Sends going through interceptors count their sheds on the way out (See countShed)
+		m.shed++
+	}
+
+	return true
+}